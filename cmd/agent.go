@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"liarslie/peer"
+	"liarslie/reader"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(agent)
+	agent.AddCommand(agentRun)
+	agent.AddCommand(agentStatus)
+	agent.AddCommand(agentShutdown)
+
+	agentRun.PersistentFlags().String("name", "", "Name of the agent to run")
+	agentStatus.PersistentFlags().String("name", "", "Name of the agent (default is every agent of the game)")
+	agentShutdown.PersistentFlags().String("name", "", "Name of the agent (default is every agent of the game)")
+}
+
+var agent = &cobra.Command{
+	Use:   "agent",
+	Short: "Run agents as long-lived processes",
+	Long: `This command runs an agent of the game in --agents as a daemon. While it runs, the other commands
+reach the agent through its control socket instead of opening its vault.`,
+}
+
+var agentRun = &cobra.Command{
+	Use:   "run",
+	Short: "Run an agent as a daemon",
+	Long:  `This command runs an agent until it is shut down, serving its control API on run/<game>/<name>.sock.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		if name == "" {
+			fmt.Println("Please provide the name of the agent with --name")
+			return
+		}
+
+		daemon, err := peer.NewDaemon(agentsConfig, name)
+		if err != nil {
+			fmt.Println("Error in starting", name+":", err)
+			return
+		}
+
+		fmt.Println("****************************************************")
+		fmt.Println("Agent", name, "is running")
+		fmt.Println("****************************************************")
+		fmt.Println("Control socket:", daemon.Socket())
+
+		ctx, stop := interruptContext()
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			// nothing to do if the daemon was shut down over its socket
+			daemon.Shutdown()
+		}()
+		if err := daemon.Serve(); err != nil {
+			fmt.Println(err)
+			daemon.Shutdown()
+			return
+		}
+		fmt.Println("Agent", name, "has shut down")
+	},
+}
+
+var agentStatus = &cobra.Command{
+	Use:   "status",
+	Short: "show the status of running agents",
+	Long:  `This command asks the daemons of the game for their status. Agents without a daemon are reported as stopped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		game := reader.GetGameID(agentsConfig)
+		agents, err := reader.GetCurrentParticipants(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, participant := range agents {
+			if name != "" && participant.USER != name {
+				continue
+			}
+			client := dialAgent(game, participant.USER)
+			if client == nil {
+				fmt.Printf("%-20s %-8s stopped\n", participant.USER, participant.ROLE)
+				continue
+			}
+			status, err := client.Status()
+			client.Close()
+			if err != nil {
+				fmt.Printf("%-20s %-8s %s\n", participant.USER, participant.ROLE, err)
+				continue
+			}
+			fmt.Printf("%-20s %-8s running  pid %-7d value %-4s rounds %-3d up %s\n",
+				status.USER, status.ROLE, status.PID, status.VALUE, status.ROUNDS, time.Since(status.STARTED).Round(time.Second))
+		}
+	},
+}
+
+var agentShutdown = &cobra.Command{
+	Use:   "shutdown",
+	Short: "shut down running agents",
+	Long:  `This command shuts down the daemon of an agent, or of every agent of the game.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		game := reader.GetGameID(agentsConfig)
+		agents, err := reader.GetCurrentParticipants(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, participant := range agents {
+			if name != "" && participant.USER != name {
+				continue
+			}
+			running, err := peer.ShutdownAgent(game, participant.USER)
+			if err != nil {
+				fmt.Println(err)
+			} else if running {
+				fmt.Println(participant.USER, "has been shut down")
+			}
+		}
+	},
+}
+
+// `dialAgent` returns a client of the daemon of agent `user`,
+// or nil if the agent does not run as a daemon. The client must be
+// closed.
+func dialAgent(game string, user string) *peer.ControlClient {
+	client, err := peer.DialAgent(game, user)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// `agentRunning` tells if agent `user` of game `game` runs as a daemon
+func agentRunning(game string, user string) bool {
+	client := dialAgent(game, user)
+	if client == nil {
+		return false
+	}
+	client.Close()
+	return true
+}
+
+// `shutdownAgents` shuts down the daemons of every agent of game `game`
+func shutdownAgents(game string, agents []reader.ParticipantSet) {
+	for _, participant := range agents {
+		if _, err := peer.ShutdownAgent(game, participant.USER); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
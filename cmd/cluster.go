@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"liarslie/reader"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/spf13/cobra"
+)
+
+// files of a cluster in the run directory of its game
+const (
+	supervisorPIDFile = "supervisor.pid"
+	supervisorLogFile = "supervisor.log"
+	clusterStateFile  = "cluster.json"
+)
+
+func init() {
+	rootCmd.AddCommand(cluster)
+	cluster.AddCommand(clusterUp)
+	cluster.AddCommand(clusterDown)
+	cluster.AddCommand(clusterStatus)
+	cluster.AddCommand(clusterSupervise)
+}
+
+var cluster = &cobra.Command{
+	Use:   "cluster",
+	Short: "Run every agent of a game in its own process",
+	Long: `This command runs one OS process per agent of the game in --agents, supervised so that agents
+that exit are restarted. PID files and logs are written to run/<game>/.`,
+}
+
+var clusterUp = &cobra.Command{
+	Use:   "up",
+	Short: "start a process for every agent",
+	Long:  `This command starts a supervisor in the background, which runs and restarts the agents of the game.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		game := reader.GetGameID(agentsConfig)
+		agents, err := reader.GetCurrentParticipants(agentsConfig)
+		if err != nil || game == "" {
+			fmt.Println("Please check your agents config:", agentsConfig)
+			return
+		}
+		if pid, ok := readPIDFile(game, supervisorPIDFile); ok && isOwnProcess(pid, "cluster", "supervise") {
+			fmt.Println("The cluster of game", game, "is already running with supervisor", pid)
+			return
+		}
+
+		if err := os.MkdirAll(reader.RunDir(game), 0755); err != nil {
+			fmt.Println(err)
+			return
+		}
+		logFile, err := os.OpenFile(filepath.Join(reader.RunDir(game), supervisorLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer logFile.Close()
+
+		supervisor, err := selfCommand("cluster", "supervise")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		supervisor.Stdout = logFile
+		supervisor.Stderr = logFile
+		detach(supervisor)
+		if err := supervisor.Start(); err != nil {
+			fmt.Println("Error in starting the supervisor:", err)
+			return
+		}
+		supervisor.Process.Release()
+
+		fmt.Println("****************************************************")
+		fmt.Println("Starting", len(agents), "agents of game", game)
+		fmt.Println("****************************************************")
+
+		// wait for every agent to answer on its control socket
+		deadline := time.Now().Add(30 * time.Second)
+		for _, agent := range agents {
+			for !agentRunning(game, agent.USER) && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+		printCluster(game, agents)
+	},
+}
+
+var clusterDown = &cobra.Command{
+	Use:   "down",
+	Short: "stop the processes of the agents",
+	Long:  `This command stops the supervisor and exactly the agent processes recorded in the run directory of the game.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		game := reader.GetGameID(agentsConfig)
+		if game == "" {
+			fmt.Println("Please check your agents config:", agentsConfig)
+			return
+		}
+		if stopCluster(game) == 0 {
+			fmt.Println("No cluster is running for game", game)
+			return
+		}
+		fmt.Println("The cluster of game", game, "is down")
+	},
+}
+
+var clusterStatus = &cobra.Command{
+	Use:   "status",
+	Short: "show the processes of the agents",
+	Long:  `This command lists the agents of the game with their process, restarts and current value.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		game := reader.GetGameID(agentsConfig)
+		agents, err := reader.GetCurrentParticipants(agentsConfig)
+		if err != nil || game == "" {
+			fmt.Println("Please check your agents config:", agentsConfig)
+			return
+		}
+		if pid, ok := readPIDFile(game, supervisorPIDFile); ok && isOwnProcess(pid, "cluster", "supervise") {
+			fmt.Println("Supervisor running with pid", pid)
+		} else {
+			fmt.Println("Supervisor is not running")
+		}
+		printCluster(game, agents)
+	},
+}
+
+var clusterSupervise = &cobra.Command{
+	Use:    "supervise",
+	Short:  "supervise the agent processes",
+	Long:   `This command runs the supervisor started by cluster up in the foreground.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := newSupervisor(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		s.run()
+	},
+}
+
+// clusterState is what the supervisor records about its agents
+type clusterState struct {
+	SUPERVISOR int
+	AGENTS     map[string]agentProcess
+}
+
+// agentProcess is the process of a supervised agent
+type agentProcess struct {
+	PID      int
+	STARTED  time.Time
+	RESTARTS int
+}
+
+// `printCluster` prints the process and value of every agent
+func printCluster(game string, agents []reader.ParticipantSet) {
+	state, _ := readClusterState(game)
+	for _, agent := range agents {
+		proc, supervised := state.AGENTS[agent.USER]
+		pid, ok := readPIDFile(game, agent.USER+".pid")
+		if !ok || !isOwnProcess(pid, "--name", agent.USER) {
+			status := "stopped"
+			if !supervised {
+				status = "not supervised"
+			}
+			fmt.Printf("%-20s %s\n", agent.USER, status)
+			continue
+		}
+		value := "?"
+		if client := dialAgent(game, agent.USER); client != nil {
+			value, _ = client.Value()
+			client.Close()
+		}
+		fmt.Printf("%-20s running  pid %-7d restarts %-3d value %-4s log %s\n",
+			agent.USER, pid, proc.RESTARTS, value, filepath.Join(reader.RunDir(game), agent.USER+".log"))
+	}
+}
+
+// `stopCluster` stops the supervisor of game `game` and the agent
+// processes it recorded, and returns how many processes it stopped.
+// Only PIDs found in the run directory are signalled, and only if
+// they still run liarslie.
+func stopCluster(game string) int {
+	stopped := 0
+	if pid, ok := readPIDFile(game, supervisorPIDFile); ok && isOwnProcess(pid, "cluster", "supervise") {
+		// the supervisor shuts its agents down before it exits
+		terminate(pid, 20*time.Second)
+		stopped++
+	}
+	os.Remove(filepath.Join(reader.RunDir(game), supervisorPIDFile))
+
+	files, _ := filepath.Glob(filepath.Join(reader.RunDir(game), "*.pid"))
+	for _, file := range files {
+		user := strings.TrimSuffix(filepath.Base(file), ".pid")
+		if pid, ok := readPIDFile(game, filepath.Base(file)); ok && isOwnProcess(pid, "--name", user) {
+			terminate(pid, 5*time.Second)
+			stopped++
+		}
+		os.Remove(file)
+	}
+	os.Remove(filepath.Join(reader.RunDir(game), clusterStateFile))
+	return stopped
+}
+
+// `selfCommand` runs this executable with `args`, passing on the
+// agents config and config file of this run
+func selfCommand(args ...string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "--agents", agentsConfig)
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	return exec.Command(self, args...), nil
+}
+
+// `readPIDFile` reads the PID stored in `name` in the run
+// directory of game `game`
+func readPIDFile(game string, name string) (int, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(reader.RunDir(game), name))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+// `writePIDFile` stores `pid` in `name` in the run directory of
+// game `game`
+func writePIDFile(game string, name string, pid int) error {
+	return ioutil.WriteFile(filepath.Join(reader.RunDir(game), name), []byte(strconv.Itoa(pid)+"\n"), 0644)
+}
+
+// `readClusterState` reads the state recorded by the supervisor
+func readClusterState(game string) (clusterState, error) {
+	var state clusterState
+	data, err := ioutil.ReadFile(filepath.Join(reader.RunDir(game), clusterStateFile))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// `isOwnProcess` reports whether process `pid` is alive and was
+// started with all of `args`, so that a PID reused by another
+// program is never signalled
+func isOwnProcess(pid int, args ...string) bool {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return false
+	}
+	cmdline, err := p.CmdlineSlice()
+	if err != nil {
+		return false
+	}
+	for _, arg := range args {
+		found := false
+		for _, have := range cmdline {
+			if have == arg {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// `terminate` asks process `pid` to exit and kills it if it is
+// still running after `grace`
+func terminate(pid int, grace time.Duration) {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return
+	}
+	if err := p.Terminate(); err != nil {
+		p.Kill()
+		return
+	}
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if running, err := p.IsRunning(); err != nil || !running {
+			return
+		}
+	}
+	p.Kill()
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"liarslie/reader"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidate)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the agents config",
+	Long:  `This command works on the agents config shared by all agents of a game.`,
+}
+
+var configValidate = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "validate an agents config",
+	Long: `This command checks an agents config, by default the one given with --agents,
+and reports duplicate agents, port collisions and malformed multiaddrs with the line they appear on.
+Configs written by older versions are accepted and validated as they would be migrated.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := agentsConfig
+		if len(args) == 1 {
+			config = args[0]
+		}
+		data, err := ioutil.ReadFile(config)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		errs := reader.ValidateGameConfig(data)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Printf("%s:%d: %s\n", config, err.LINE, err.MSG)
+			}
+			fmt.Println(" ")
+			fmt.Println(config, "has", len(errs), "problems")
+			return
+		}
+
+		game, _, _ := reader.ParseGameConfig(data)
+		fmt.Println(config, "is valid:", len(game.AGENTS), "agents in game", game.GAMEID, "version", game.VERSION)
+	},
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os/exec"
+)
+
+// `detach` leaves `cmd` attached on platforms without sessions
+func detach(cmd *exec.Cmd) {}
@@ -2,10 +2,11 @@ package cmd
 
 import (
 	"fmt"
-	"liarslie/peer"
+	"liarslie/game"
 	"liarslie/reader"
+	"os"
 	"strconv"
-	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -20,9 +21,16 @@ func init() {
 	extend.PersistentFlags().String("max-value", "", "Max value that a liar can broadcast")
 	extend.PersistentFlags().String("num-agents", "", "Total number of agents in the network")
 	extend.PersistentFlags().String("liar-ratio", "", "Ratio between liars and truth-tellers in the network")
+	extend.PersistentFlags().String("liar-value", "", "Value that liars broadcast (default is max-value * liar-ratio, required for non-numeric values)")
+	addKeysFlags(extend)
+	extend.PersistentFlags().String("transport", reader.TransportTCP, "Transport agents listen on: tcp, quic, ws or mixed")
+	extend.PersistentFlags().String("port-range", reader.DefaultPortRange.String(), "Range of ports agents listen on, as min-max")
+	addRoundsFlags(extend)
 
 	playexpert.PersistentFlags().String("num-agents", "", "Total number of agents in the network")
 	playexpert.PersistentFlags().String("liar-ratio", "", "Ratio between liars and truth-tellers in the network")
+	addRoundsFlags(playexpert)
+	addOutputFlag(playexpert)
 
 	kill.PersistentFlags().String("id", "", "Id of the agent")
 }
@@ -49,47 +57,87 @@ var extend = &cobra.Command{
 		value, _ := cmd.Flags().GetString("value")
 		maxValue, _ := cmd.Flags().GetString("max-value")
 		liarRatio, _ := cmd.Flags().GetString("liar-ratio")
+		liarValue, _ := cmd.Flags().GetString("liar-value")
+		transport, _ := cmd.Flags().GetString("transport")
+		portRange, _ := cmd.Flags().GetString("port-range")
 
-		// convert string to integer
-		val, valConversionError := strconv.Atoi(value)
+		rounds, schedule, err := readRoundsFlags(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		g, err := game.Open(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer pushEvents(g.ID())()
+		trail, _ := cmd.Flags().GetBool("liars-trail")
+		g.SetLiarsTrail(trail)
+
+		keys, err := readKeys(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		values, err := g.Values()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// convert string to integer; the values are parsed by the
+		// type of the game
 		agents, agentConversionError := strconv.Atoi(num)
-		max, maxConversionError := strconv.Atoi(maxValue)
+		max, maxConversionError := readMaxValue(maxValue, liarValue != "" || len(keys) > 0 || !values.TYPE.Numeric())
 		ratio, liarRatioConversionError := strconv.ParseFloat(liarRatio, 32)
-		config := "agents.json"
 
-		if valConversionError != nil || agentConversionError != nil || maxConversionError != nil || liarRatioConversionError != nil {
+		if (value == "") == (len(keys) == 0) || agentConversionError != nil || maxConversionError != nil || liarRatioConversionError != nil {
 			fmt.Println("Error in value conversion.")
 			return
 		}
-
-		// call reader append file to generate config.
-		appendError := reader.AddAgentsToConfig(agents, val, max, ratio, config)
-		if appendError != nil {
-			fmt.Println("Error in saving agents.json.")
+		err = g.AddAgents(game.Params{
+			VALUE:     reader.Value(value),
+			LIE:       reader.Value(liarValue),
+			KEYS:      keys,
+			MAXVALUE:  max,
+			AGENTS:    agents,
+			RATIO:     ratio,
+			TRANSPORT: transport,
+			PORTRANGE: portRange,
+		})
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
 
-		fmt.Println("Updated agents.json with new agents.")
+		fmt.Println("Updated", agentsConfig, "with new agents.")
+		fmt.Println("Seed:", reader.Seed())
+
+		// Ctrl-C abandons the round and stops the agents started for it
+		ctx, stop := interruptContext()
+		defer stop()
+		if rounds > 1 || cmd.Flags().Changed("truth") {
+			fmt.Println("******************************************************************************************")
+			fmt.Println("Starting liarslie in expert mode... Attempting to compute network value for", rounds, "rounds")
+			fmt.Println("******************************************************************************************")
+			playRounds(ctx, g, game.ModeExpert, rounds, schedule, outputText, os.Stdout, os.Stdout)
+			return
+		}
 
 		fmt.Println("******************************************************************************************")
 		fmt.Println("Starting liarslie in expert mode... Attempting to compute network value for only one round")
 		fmt.Println("******************************************************************************************")
 
-		// get agents from config
-		latest_agents := reader.GetCurrentParticipants("agents.json")
-		numAgents := len(latest_agents)
-
-		var wg sync.WaitGroup
-		wg.Add(numAgents)
-
-		for i := 0; i < numAgents; i++ {
-			go func(i int, latest_agents []reader.ParticipantSet) {
-				defer wg.Done()
-				peer.RunAsExpert(i, latest_agents, numAgents, true)
-			}(i, latest_agents)
+		started := time.Now()
+		if _, err := g.Play(ctx, game.ModeExpert); err != nil {
+			fmt.Println(err)
+			return
 		}
 
-		wg.Wait()
+		fmt.Println(" ")
+		fmt.Println("Agreement reached in", time.Since(started))
 
 		fmt.Println(" ")
 		fmt.Println("********************************************************")
@@ -103,58 +151,67 @@ var playexpert = &cobra.Command{
 	Short: "Play liarslie as expert",
 	Long:  `This command starts p2p networking among the agents and computes the true network value in expert mode`,
 	Run: func(cmd *cobra.Command, args []string) {
+		format, out, progress, err := beginOutput(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
-		fmt.Println("******************************************************************************************")
-		fmt.Println("Starting liarslie in expert mode... Attempting to compute network value for only one round")
-		fmt.Println("******************************************************************************************")
+		rounds, schedule, err := readRoundsFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
+		}
 
 		// get data from arguments
 		num, _ := cmd.Flags().GetString("num-agents")
 		liarRatio, _ := cmd.Flags().GetString("liar-ratio")
 
-		// get vault instance
-		db := reader.GetInstance()
-
 		// convert string to integer
 		numAgents, agentConversionError := strconv.Atoi(num)
 		_, liarRatioConversionError := strconv.ParseFloat(liarRatio, 32)
 
 		if agentConversionError != nil || liarRatioConversionError != nil {
-			fmt.Println("Error in value conversion.")
+			fmt.Fprintln(progress, "Error in value conversion.")
 			return
 		}
-		agents := reader.GetCurrentParticipants("agents.json")
-
-		truthValue := -1
-		// go through the vault to compute the truth value of network
-		// in expert mode, given a low liar-ratio, all the entries
-		// of the vault is updated to the truest value if `extend` is called earlier.
-		// In any other case `playexpert` may return a false value as well since numAgents
-		// may or may not be equal to total number of keys in the vault and truth value is decided
-		// by frequency.
-		for i := 0; i < numAgents; i++ {
-			networkValue, _ := db.Get([]byte(agents[i].IP))
-			value, _ := strconv.Atoi(string(networkValue))
-			if value > truthValue {
-				truthValue = value
-			}
-		}
-		db.Close()
-
-		if truthValue < 0 {
-			fmt.Println(" ")
-			fmt.Println("*******************************************")
-			fmt.Println("Please check your agents config. Its empty!")
-			fmt.Println("*******************************************")
-		} else {
-			fmt.Println(" ")
-			fmt.Println("****************************************")
-			fmt.Println("The computed network value is", truthValue)
-			fmt.Println("****************************************")
+		g, err := game.Open(agentsConfig)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
+		}
+		defer pushEvents(g.ID())()
+		trail, _ := cmd.Flags().GetBool("liars-trail")
+		g.SetLiarsTrail(trail)
+
+		// more rounds are played anew, by every agent of the game
+		if rounds > 1 || cmd.Flags().Changed("truth") {
+			ctx, stop := interruptContext()
+			defer stop()
+			fmt.Fprintln(progress, "******************************************************************************************")
+			fmt.Fprintln(progress, "Starting liarslie in expert mode... Attempting to compute network value for", rounds, "rounds")
+			fmt.Fprintln(progress, "******************************************************************************************")
+			fmt.Fprintln(progress, "Seed:", reader.Seed())
+			playRounds(ctx, g, game.ModeExpert, rounds, schedule, format, out, progress)
+			return
 		}
 
-		fmt.Println(" ")
-		fmt.Println("One round of play in expert mode is complete.. Liarslie is shutting down..")
+		fmt.Fprintln(progress, "******************************************************************************************")
+		fmt.Fprintln(progress, "Starting liarslie in expert mode... Attempting to compute network value for only one round")
+		fmt.Fprintln(progress, "******************************************************************************************")
+		result, err := g.Decided(numAgents)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
+		}
+
+		if err := writeResult(out, format, result); err != nil {
+			fmt.Fprintln(progress, "Error in writing the result:", err)
+			return
+		}
+
+		fmt.Fprintln(progress, " ")
+		fmt.Fprintln(progress, "One round of play in expert mode is complete.. Liarslie is shutting down..")
 	},
 }
 
@@ -164,20 +221,17 @@ var kill = &cobra.Command{
 	Long:  `This command can be used to remove a certain agent from a network.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		id, _ := cmd.Flags().GetString("id")
-		IP := reader.GetParticpantIP("agents.json", id)
-		if len(IP) == 0 {
-			fmt.Println("No ID by name provided exists on the network")
-		} else {
-			// get vault instance
-			db := reader.GetInstance()
-
-			// remove data from vault
-			// this triggers the discovery module to
-			// remove the respective peerID from the network
-			db.Delete([]byte(IP))
-
-			fmt.Println(" ")
-			fmt.Println(id, "is removed from the network")
+		g, err := game.Open(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := g.Kill(id); err != nil {
+			fmt.Println(err)
+			return
 		}
+
+		fmt.Println(" ")
+		fmt.Println(id, "is removed from the network")
 	},
 }
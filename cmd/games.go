@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"liarslie/game"
+	"liarslie/reader"
+)
+
+// `resetGame` stops the cluster of the game played with `config`,
+// whose supervisor would restart its agents, and resets the game
+// with `game.Reset`
+func resetGame(config string) error {
+	if previous := reader.GetGameID(config); previous != "" {
+		stopCluster(previous)
+	}
+	return game.Reset(config)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"liarslie/reader"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(history)
+	history.AddCommand(historyList)
+	history.AddCommand(historyShow)
+}
+
+var history = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect the history of past games",
+	Long:  `This command reads the append-only ledger recording every round played in every game.`,
+}
+
+var historyList = &cobra.Command{
+	Use:   "list",
+	Short: "list games with a history",
+	Long:  `This command lists every game with recorded rounds and whether its ledger is intact.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		games, err := reader.ListLedgers()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if len(games) == 0 {
+			fmt.Println("No games have been played yet")
+			return
+		}
+		for _, game := range games {
+			records, err := reader.ReadLedger(game)
+			if err == nil {
+				err = reader.VerifyLedger(records)
+			}
+			status := "intact"
+			if err != nil {
+				status = err.Error()
+			}
+			fmt.Println(game, len(records), "rounds", status)
+		}
+	},
+}
+
+var historyShow = &cobra.Command{
+	Use:   "show <game>",
+	Short: "show the rounds of a game",
+	Long:  `This command prints every round recorded for a game and verifies the hash chain of its ledger.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := reader.ReadLedger(args[0])
+		if err != nil {
+			fmt.Println("No history for game", args[0])
+			return
+		}
+
+		for _, record := range records {
+			fmt.Println(" ")
+			fmt.Println("*************************************************")
+			fmt.Println("Round", record.ROUND, "in", record.MODE, "mode")
+			fmt.Println("*************************************************")
+			fmt.Println("Started:    ", record.STARTED.Format(time.RFC3339))
+			fmt.Println("Duration:   ", record.DURATION)
+			fmt.Println("Truth:      ", record.TRUTH)
+			if record.SEED != 0 {
+				fmt.Println("Seed:       ", record.SEED)
+			}
+			fmt.Println("Hash:       ", record.HASH)
+			for _, agent := range record.AGENTS {
+				role := "truth-teller"
+				if agent.LIAR {
+					role = "liar"
+				}
+				fmt.Printf("  %-20s %-12s reported %-4s decided %-4s received %d messages in %s\n",
+					agent.USER, role, agent.REPORTED, agent.DECIDED, agent.RECEIVED, agent.DURATION)
+			}
+		}
+
+		fmt.Println(" ")
+		if err := reader.VerifyLedger(records); err != nil {
+			fmt.Println("Ledger verification failed:", err)
+		} else {
+			fmt.Println("Ledger verified:", len(records), "rounds intact")
+		}
+	},
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"liarslie/peer"
+	"liarslie/reader"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `openAPIDocument` generates the OpenAPI 3 document of `routes`.
+// Request and response schemas are derived from the types of the
+// routes, so the document follows the handlers as they change.
+func openAPIDocument(routes []route) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		operation := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+
+		var parameters []interface{}
+		for _, part := range strings.Split(rt.path, "/") {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     strings.Trim(part, "{}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+
+		if rt.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(rt.request), schemas)),
+			}
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(rt.status)}
+		if _, ok := rt.response.(eventStream); ok {
+			success["content"] = map[string]interface{}{
+				"text/event-stream": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(peer.Event{}), schemas)},
+			}
+		} else if rt.response != nil {
+			success["content"] = jsonContent(schemaOf(reflect.TypeOf(rt.response), schemas))
+		} else if rt.status != http.StatusNoContent {
+			success["content"] = jsonContent(map[string]interface{}{"type": "object"})
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(rt.status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     jsonContent(schemaOf(reflect.TypeOf(errorResponse{}), schemas)),
+			},
+		}
+
+		item, ok := paths[rt.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "liarslie",
+			"version": version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// `operationID` names the operation of a route after its method
+// and path, e.g. postGamesPlay
+func operationID(rt route) string {
+	name := strings.ToLower(rt.method)
+	for _, part := range strings.Split(rt.path, "/") {
+		part = strings.Trim(part, "{}.")
+		if part != "" {
+			name += strings.ToUpper(part[:1]) + strings.ReplaceAll(part[1:], ".", "")
+		}
+	}
+	return name
+}
+
+// `jsonContent` is the content of a JSON body with schema `schema`
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// `schemaOf` returns the JSON schema of `t` as encoded by
+// encoding/json. Named structs are added to `schemas` and
+// referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	case reflect.TypeOf(reader.Value("")):
+		return map[string]interface{}{
+			"oneOf":       []interface{}{map[string]interface{}{"type": "integer"}, map[string]interface{}{"type": "string"}},
+			"nullable":    true,
+			"description": "value in the canonical encoding of the value type of the game, integers as numbers",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			// reserve the name first, for types referring to themselves
+			schemas[name] = nil
+			properties := make(map[string]interface{})
+			addProperties(t, properties, schemas)
+			schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// `addProperties` adds the fields of struct `t` to `properties`,
+// promoting the fields of embedded structs like encoding/json
+func addProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, properties, schemas)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type, schemas)
+	}
+}
+
+// `schemaName` names the schema of a struct type, e.g. GameResult
+// for reader.GameResult and GameResponse for gameResponse
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return "Object"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
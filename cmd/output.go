@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"liarslie/game"
+	"liarslie/peer"
+	"liarslie/reader"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// formats of `--output`
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+	outputJUnit = "junit"
+)
+
+// `addOutputFlag` adds `--output` to a command producing a result
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("output", outputText, "Format of the result: text, json, csv or junit")
+}
+
+// `addRoundsFlags` adds `--rounds`, `--truth` and `--liars-trail`
+// to a command playing rounds
+func addRoundsFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("rounds", "1", "Number of rounds to play")
+	cmd.PersistentFlags().String("truth", "", "How the true value changes between rounds: step:DELTA[/EVERY], walk:STEP or file:PATH")
+	cmd.PersistentFlags().Bool("liars-trail", false, "Make liars report the previous true value when it changes, instead of their own lie")
+}
+
+// `readRoundsFlags` reads the number of rounds and the truth
+// schedule of `cmd`
+func readRoundsFlags(cmd *cobra.Command) (int, game.TruthSchedule, error) {
+	roundsFlag, _ := cmd.Flags().GetString("rounds")
+	truthFlag, _ := cmd.Flags().GetString("truth")
+	rounds, err := strconv.Atoi(roundsFlag)
+	if err != nil || rounds < 1 {
+		return 0, nil, fmt.Errorf("invalid number of rounds %q", roundsFlag)
+	}
+	schedule, err := game.ParseTruthSchedule(truthFlag)
+	if err != nil {
+		return 0, nil, err
+	}
+	return rounds, schedule, nil
+}
+
+// `beginOutput` reads the `--output` flag of `cmd` and returns the
+// format, the writer of the result and the writer of progress
+// messages. With a structured format, stdout only carries the
+// result: progress messages, of the command and of the agents it
+// runs, go to stderr.
+func beginOutput(cmd *cobra.Command) (string, io.Writer, io.Writer, error) {
+	format, _ := cmd.Flags().GetString("output")
+	switch format {
+	case outputText:
+		return format, os.Stdout, os.Stdout, nil
+	case outputJSON, outputCSV, outputJUnit:
+		peer.Progress = os.Stderr
+		return format, os.Stdout, os.Stderr, nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// `writeResult` writes the result of a round in `format`
+func writeResult(w io.Writer, format string, result reader.GameResult) error {
+	switch format {
+	case outputJSON:
+		return writeJSON(w, result)
+	case outputCSV:
+		return writeCSV(w, result)
+	case outputJUnit:
+		return writeJUnit(w, result)
+	}
+	writeText(w, result)
+	return nil
+}
+
+// `writeTracking` writes the results of a run of several rounds in
+// `format`, one entry per round
+func writeTracking(w io.Writer, format string, tracking game.Tracking) error {
+	switch format {
+	case outputJSON:
+		return writeJSON(w, tracking)
+	case outputCSV:
+		return writeTrackingCSV(w, tracking)
+	case outputJUnit:
+		return writeTrackingJUnit(w, tracking)
+	}
+	writeTrackingText(w, tracking)
+	return nil
+}
+
+// `writeTrackingText` prints a line per round and how closely the
+// network tracked the truth
+func writeTrackingText(w io.Writer, tracking game.Tracking) {
+	fmt.Fprintln(w, " ")
+	fmt.Fprintf(w, "%-6s %-6s %-8s %-8s %s\n", "ROUND", "TRUTH", "NETWORK", "CORRECT", "ACCURACY")
+	for _, result := range tracking.ROUNDS {
+		decided := string(result.DECIDED)
+		if decided == "" {
+			decided = "-"
+		}
+		fmt.Fprintf(w, "%-6d %-6s %-8s %-8t %.0f%%\n", result.ROUNDS, result.TRUTH, decided, result.CORRECT, 100*result.ACCURACY)
+	}
+	fmt.Fprintln(w, "*****************************************")
+	fmt.Fprintf(w, "The network decided the truth in %d of %d rounds\n", tracking.CORRECT, len(tracking.ROUNDS))
+	fmt.Fprintf(w, "and in %d of the %d rounds the truth changed in\n", tracking.TRACKED, tracking.CHANGES)
+	fmt.Fprintf(w, "Mean accuracy of the agents: %.0f%%\n", 100*tracking.ACCURACY)
+	fmt.Fprintln(w, "*****************************************")
+}
+
+// `writeTrackingCSV` writes one row per round
+func writeTrackingCSV(w io.Writer, tracking game.Tracking) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"GAME", "MODE", "SEED", "ROUND", "TRUTH", "NETWORK", "CORRECT", "ACCURACY", "MESSAGES", "DURATION"})
+	for _, result := range tracking.ROUNDS {
+		out.Write([]string{
+			result.GAME,
+			result.MODE,
+			strconv.FormatInt(result.SEED, 10),
+			strconv.Itoa(result.ROUNDS),
+			string(result.TRUTH),
+			string(result.DECIDED),
+			strconv.FormatBool(result.CORRECT),
+			strconv.FormatFloat(result.ACCURACY, 'f', 4, 64),
+			strconv.Itoa(result.MESSAGES),
+			result.DURATION.String(),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// `writeTrackingJUnit` writes a JUnit report with one test case per
+// round, failing when the network did not decide the truth
+func writeTrackingJUnit(w io.Writer, tracking game.Tracking) error {
+	var suite junitSuite
+	for _, result := range tracking.ROUNDS {
+		suite.Name = "liarslie." + result.GAME
+		c := junitCase{
+			Name:      fmt.Sprintf("round %d", result.ROUNDS),
+			ClassName: "liarslie." + result.MODE,
+			Time:      result.DURATION.Seconds(),
+		}
+		if !result.CORRECT {
+			c.Failure = &junitFailure{Message: fmt.Sprintf("decided %q, the truth is %s", result.DECIDED, result.TRUTH)}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+		suite.Time += result.DURATION.Seconds()
+	}
+	suite.Properties = []junitProperty{
+		{Name: "rounds", Value: strconv.Itoa(len(tracking.ROUNDS))},
+		{Name: "accuracy", Value: strconv.FormatFloat(tracking.ACCURACY, 'f', 4, 64)},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// `writeText` prints the network value and the ground truth
+func writeText(w io.Writer, result reader.GameResult) {
+	if result.DECIDED == "" {
+		fmt.Fprintln(w, " ")
+		fmt.Fprintln(w, "*******************************************")
+		fmt.Fprintln(w, "Please check your agents config. Its empty!")
+		fmt.Fprintln(w, "*******************************************")
+		return
+	}
+	if len(result.KEYS) > 0 {
+		writeKeysText(w, result)
+		return
+	}
+	fmt.Fprintln(w, " ")
+	fmt.Fprintln(w, "*****************************************")
+	fmt.Fprintln(w, "The computed network value is", result.DECIDED)
+	fmt.Fprintln(w, "*****************************************")
+	printGroundTruth(w, result.GAME, result.DECIDED)
+}
+
+// `writeKeysText` prints the value the network decided for every
+// key of a game of keys, compared with its truth
+func writeKeysText(w io.Writer, result reader.GameResult) {
+	correct := 0
+	fmt.Fprintln(w, " ")
+	fmt.Fprintf(w, "%-16s %-12s %-12s %-8s %s\n", "KEY", "TRUTH", "NETWORK", "CORRECT", "ACCURACY")
+	for _, key := range result.KEYS {
+		decided := string(key.DECIDED)
+		if decided == "" {
+			decided = "-"
+		}
+		if key.CORRECT {
+			correct++
+		}
+		fmt.Fprintf(w, "%-16s %-12s %-12s %-8t %.0f%%\n", key.KEY, key.TRUTH, decided, key.CORRECT, 100*key.ACCURACY)
+	}
+	fmt.Fprintln(w, "*****************************************")
+	fmt.Fprintf(w, "The network decided the truth of %d of %d keys\n", correct, len(result.KEYS))
+	fmt.Fprintln(w, "with", len(result.LIARS), "liars in the network")
+	fmt.Fprintln(w, "*****************************************")
+}
+
+// `writeJSON` writes `v` as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// `writeCSV` writes one row per agent. The columns before USER
+// describe the round and repeat on every row. Games of keys get one
+// row per key instead.
+func writeCSV(w io.Writer, result reader.GameResult) error {
+	out := csv.NewWriter(w)
+	if len(result.KEYS) > 0 {
+		out.Write([]string{"GAME", "MODE", "SEED", "ROUNDS", "KEY", "TRUTH", "NETWORK", "CORRECT", "ACCURACY"})
+		for _, key := range result.KEYS {
+			out.Write([]string{
+				result.GAME,
+				result.MODE,
+				strconv.FormatInt(result.SEED, 10),
+				strconv.Itoa(result.ROUNDS),
+				key.KEY,
+				string(key.TRUTH),
+				string(key.DECIDED),
+				strconv.FormatBool(key.CORRECT),
+				strconv.FormatFloat(key.ACCURACY, 'f', 4, 64),
+			})
+		}
+		out.Flush()
+		return out.Error()
+	}
+	out.Write([]string{"GAME", "MODE", "SEED", "ROUNDS", "TRUTH", "NETWORK", "CORRECT",
+		"USER", "LIAR", "REPORTED", "DECIDED", "RECEIVED", "DURATION"})
+	for _, agent := range result.AGENTS {
+		out.Write([]string{
+			result.GAME,
+			result.MODE,
+			strconv.FormatInt(result.SEED, 10),
+			strconv.Itoa(result.ROUNDS),
+			string(result.TRUTH),
+			string(result.DECIDED),
+			strconv.FormatBool(result.CORRECT),
+			agent.USER,
+			strconv.FormatBool(agent.LIAR),
+			agent.REPORTED,
+			agent.DECIDED,
+			strconv.Itoa(agent.RECEIVED),
+			agent.DURATION.String(),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// JUnit report elements, as understood by CI dashboards
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       float64         `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// `writeJUnit` writes a JUnit report with one test case for the
+// network, one per key of a game of keys and one per agent. A case
+// fails when its decided value differs from the ground truth.
+func writeJUnit(w io.Writer, result reader.GameResult) error {
+	class := "liarslie." + result.MODE
+	truth := string(result.TRUTH)
+	suite := junitSuite{
+		Name: "liarslie." + result.GAME,
+		Time: result.DURATION.Seconds(),
+		Properties: []junitProperty{
+			{Name: "seed", Value: strconv.FormatInt(result.SEED, 10)},
+			{Name: "rounds", Value: strconv.Itoa(result.ROUNDS)},
+			{Name: "truth", Value: truth},
+			{Name: "messages", Value: strconv.Itoa(result.MESSAGES)},
+		},
+	}
+	addCase := func(name string, decided string, truth string, duration float64) {
+		c := junitCase{Name: name, ClassName: class, Time: duration}
+		if decided != truth {
+			c.Failure = &junitFailure{Message: fmt.Sprintf("decided %q, the truth is %s", decided, truth)}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+	}
+
+	addCase("network", string(result.DECIDED), truth, result.DURATION.Seconds())
+	for _, key := range result.KEYS {
+		addCase("key "+key.KEY, string(key.DECIDED), string(key.TRUTH), 0)
+	}
+	for _, agent := range result.AGENTS {
+		name := agent.USER
+		if agent.LIAR {
+			name += " (liar)"
+		}
+		addCase(name, agent.DECIDED, truth, agent.DURATION.Seconds())
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
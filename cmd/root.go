@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"liarslie/peer"
+	"liarslie/reader"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
-	"github.com/shirou/gopsutil/v3/process"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -13,6 +20,13 @@ import (
 var (
 	// This is used for config file
 	cfgFile string
+	// This is used for the agents config of the current game
+	agentsConfig string
+	// This is used for the seed of all random choices
+	seedFlag string
+	// These are used for the timeouts of the phases of expert rounds
+	discoveryTimeoutFlag string
+	roundTimeoutFlag     string
 
 	rootCmd = &cobra.Command{
 		Use:   "liarslie",
@@ -28,6 +42,10 @@ func Execute() error {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.liarslie.yaml)")
+	rootCmd.PersistentFlags().StringVar(&agentsConfig, "agents", reader.DefaultConfig, "agents config of the game to play")
+	rootCmd.PersistentFlags().StringVar(&seedFlag, "seed", "", "seed of all random choices, to reproduce a run (default is random)")
+	rootCmd.PersistentFlags().StringVar(&discoveryTimeoutFlag, "discovery-timeout", peer.DefaultTimeouts.DISCOVERY.String(), "how long expert agents search for a first peer, 0 waits forever")
+	rootCmd.PersistentFlags().StringVar(&roundTimeoutFlag, "round-timeout", peer.DefaultTimeouts.ROUND.String(), "how long expert agents wait for the votes of every peer, 0 waits forever")
 }
 
 func er(msg interface{}) {
@@ -49,28 +67,62 @@ func initConfig() {
 		viper.SetConfigName(".liarslie")
 	}
 
+	viper.SetDefault("vault", reader.BackendBitcask)
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
-}
 
-// `KillProcess` kills a process by name `name`
-// Used for killing `liarslie`
-func KillProcess(name string) error {
-	processes, err := process.Processes()
-	if err != nil {
-		return err
+	// select the storage backend of the agent vaults
+	if err := reader.SetVaultBackend(viper.GetString("vault")); err != nil {
+		er(err)
 	}
-	for _, p := range processes {
-		n, err := p.Name()
+
+	if seedFlag != "" {
+		seed, err := strconv.ParseInt(seedFlag, 10, 64)
 		if err != nil {
-			return err
-		}
-		if n == name {
-			return p.Kill()
+			er(fmt.Sprintf("invalid seed %q", seedFlag))
 		}
+		reader.SetSeed(seed)
+	}
+
+	// bound the phases of expert rounds, so that a stuck game ends
+	discoveryTimeout, err := time.ParseDuration(discoveryTimeoutFlag)
+	if err != nil {
+		er(fmt.Sprintf("invalid discovery timeout %q", discoveryTimeoutFlag))
+	}
+	roundTimeout, err := time.ParseDuration(roundTimeoutFlag)
+	if err != nil {
+		er(fmt.Sprintf("invalid round timeout %q", roundTimeoutFlag))
+	}
+	peer.DefaultTimeouts = peer.Timeouts{DISCOVERY: discoveryTimeout, ROUND: roundTimeout}
+}
+
+// `interruptContext` returns a context that is cancelled on SIGINT
+// or SIGTERM, so that a command can stop what it is doing and release
+// the hosts, ports and vaults it holds. A second signal ends the
+// process right away.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// `printGroundTruth` compares the computed network value with the
+// ground truth of game `game`. Only the reporting layer reads it.
+func printGroundTruth(w io.Writer, game string, computed reader.Value) {
+	truth, err := reader.ReadGroundTruth(game)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, "The ground truth is", truth.VALUE, "with", len(truth.LIARS), "liars in the network")
+	if computed == truth.VALUE {
+		fmt.Fprintln(w, "The network found the true value")
+	} else {
+		fmt.Fprintln(w, "The network was misled by its liars")
 	}
-	return fmt.Errorf("process not found")
 }
@@ -0,0 +1,391 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"liarslie/game"
+	"liarslie/peer"
+	"liarslie/reader"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(run)
+	addOutputFlag(run)
+}
+
+var run = &cobra.Command{
+	Use:   "run <scenario>",
+	Short: "Run an experiment described by a scenario file",
+	Long: `This command runs a scenario file (YAML or JSON) end to end: it creates a game with the agent groups
+of the scenario, applies its timed events, plays one round of its protocol and writes a results file.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, out, progress, err := beginOutput(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		scenario, err := loadScenario(args[0])
+		if err != nil {
+			fmt.Fprintln(progress, "Error in scenario", args[0]+":", err)
+			return
+		}
+		// --seed takes precedence over the seed of the scenario
+		if seedFlag == "" && scenario.SEED != 0 {
+			reader.SetSeed(scenario.SEED)
+		}
+
+		fmt.Fprintln(progress, "****************************************************************")
+		fmt.Fprintln(progress, "Running scenario", scenario.NAME, "with the", scenario.PROTOCOL, "protocol")
+		fmt.Fprintln(progress, "****************************************************************")
+		fmt.Fprintln(progress, "Seed:", reader.Seed())
+
+		// Ctrl-C ends the run, releasing the agents of its round
+		ctx, stop := interruptContext()
+		defer stop()
+		result, err := runScenario(ctx, scenario, progress)
+		reader.CloseVaults()
+		if err != nil {
+			fmt.Fprintln(progress, "Error in running scenario:", err)
+			return
+		}
+		if err := reader.WriteScenarioResult(scenario.RESULTS, result); err != nil {
+			fmt.Fprintln(progress, "Error in saving", scenario.RESULTS+":", err)
+			return
+		}
+
+		// JSON carries the whole run, the other formats its round
+		if format == outputJSON {
+			err = writeJSON(out, result)
+		} else {
+			err = writeResult(out, format, result.GameResult)
+		}
+		if err != nil {
+			fmt.Fprintln(progress, "Error in writing the result:", err)
+			return
+		}
+		fmt.Fprintln(progress, "Results written to", scenario.RESULTS)
+	},
+}
+
+// `loadScenario` reads and validates a scenario file with viper
+func loadScenario(file string) (reader.Scenario, error) {
+	var scenario reader.Scenario
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return scenario, err
+	}
+	if err := v.Unmarshal(&scenario); err != nil {
+		return scenario, err
+	}
+	if err := scenario.Validate(); err != nil {
+		return scenario, err
+	}
+	// the agents config is rewritten by the run
+	for _, out := range []string{scenario.CONFIG, scenario.RESULTS} {
+		if filepath.Clean(out) == filepath.Clean(file) {
+			return scenario, fmt.Errorf("%s would overwrite the scenario file", out)
+		}
+	}
+	return scenario, nil
+}
+
+// scenarioRun is the state of a running scenario
+type scenarioRun struct {
+	scenario reader.Scenario
+	game     string
+	ports    reader.PortRange
+	// agents of every group that has joined
+	members map[string][]string
+	crashed map[string]bool
+	// current partition as lists of groups, nil when healed
+	partition [][]string
+	// network of a standard round, once it started
+	network *peer.LocalNetwork
+	events  []reader.EventRecord
+	// progress receives the events and errors of the run
+	progress io.Writer
+}
+
+// `runScenario` creates the game of a scenario, applies its events
+// on schedule and plays its round, until `ctx` is done. Events and
+// errors are reported to `progress`.
+func runScenario(ctx context.Context, scenario reader.Scenario, progress io.Writer) (reader.ScenarioResult, error) {
+	resetGame(scenario.CONFIG)
+	ports, _ := reader.ParsePortRange(scenario.PORTRANGE)
+	r := &scenarioRun{
+		scenario: scenario,
+		ports:    ports,
+		members:  make(map[string][]string),
+		crashed:  make(map[string]bool),
+		progress: progress,
+	}
+
+	// groups joining later are added by their join event
+	joinsLater := make(map[string]bool)
+	for _, event := range scenario.EVENTS {
+		if event.TYPE == reader.EventJoin {
+			joinsLater[event.GROUP] = true
+		}
+	}
+	for _, group := range scenario.GROUPS {
+		if !joinsLater[group.NAME] {
+			if err := r.addGroup(group.NAME); err != nil {
+				return reader.ScenarioResult{}, err
+			}
+		}
+	}
+	r.game = reader.GetGameID(scenario.CONFIG)
+	defer pushEvents(r.game)()
+
+	// order the events, scheduling the end of timed partitions
+	timeline := append([]reader.ScenarioEvent(nil), scenario.EVENTS...)
+	for _, event := range scenario.EVENTS {
+		if event.TYPE == reader.EventPartition && event.DURATION > 0 {
+			timeline = append(timeline, reader.ScenarioEvent{AT: event.AT + event.DURATION, TYPE: reader.EventHeal})
+		}
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].AT < timeline[j].AT
+	})
+
+	started := time.Now()
+	wait := func(at time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(started.Add(at))):
+			return nil
+		}
+	}
+
+	next := 0
+	for ; next < len(timeline) && timeline[next].AT <= scenario.PLAY; next++ {
+		if err := wait(timeline[next].AT); err != nil {
+			return reader.ScenarioResult{}, err
+		}
+		if err := r.apply(timeline[next]); err != nil {
+			return reader.ScenarioResult{}, err
+		}
+	}
+
+	// play the round while the remaining events unfold
+	if err := wait(scenario.PLAY); err != nil {
+		return reader.ScenarioResult{}, err
+	}
+	roundStarted := time.Now()
+	done := make(chan struct{})
+	outcomes, err := r.startRound(ctx, done)
+	if err != nil {
+		return reader.ScenarioResult{}, err
+	}
+	for ; next < len(timeline); next++ {
+		if err := wait(timeline[next].AT); err != nil {
+			<-done
+			return reader.ScenarioResult{}, err
+		}
+		if err := r.apply(timeline[next]); err != nil {
+			<-done
+			return reader.ScenarioResult{}, err
+		}
+	}
+	<-done
+	if ctx.Err() != nil {
+		return reader.ScenarioResult{}, ctx.Err()
+	}
+
+	record, err := game.RecordRound(r.game, scenario.PROTOCOL, roundStarted, outcomes)
+	if err != nil {
+		fmt.Fprintln(r.progress, err)
+	}
+	return reader.ScenarioResult{
+		SCENARIO:   scenario.NAME,
+		GameResult: reader.ResultOfRound(*record),
+		STARTED:    started,
+		ELAPSED:    time.Since(started),
+		GROUPS:     r.members,
+		EVENTS:     r.events,
+	}, nil
+}
+
+// `startRound` starts a round with every agent of the game. The
+// outcomes are filled in, and expert agents stopped, by the time
+// `done` is closed. The round ends early when `ctx` is done.
+func (r *scenarioRun) startRound(ctx context.Context, done chan struct{}) ([]peer.Outcome, error) {
+	agents, err := reader.GetCurrentParticipants(r.scenario.CONFIG)
+	if err != nil {
+		return nil, err
+	}
+	numAgents := len(agents)
+	outcomes := make([]peer.Outcome, numAgents)
+
+	if r.scenario.PROTOCOL == reader.ProtocolStandard {
+		r.network, err = peer.NewLocalNetwork(r.game, agents, reader.Seed())
+		if err != nil {
+			return nil, err
+		}
+		r.network.SetTimeout(r.scenario.TIMEOUT)
+		for agent := range r.crashed {
+			r.network.Crash(agent)
+		}
+		if r.partition != nil {
+			r.network.Partition(r.sides())
+		}
+	}
+
+	experts := make([]*peer.Agent, numAgents)
+	var wg sync.WaitGroup
+	for i := 0; i < numAgents; i++ {
+		outcomes[i].USER = agents[i].USER
+		if r.crashed[agents[i].USER] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if r.network != nil {
+				outcomes[i] = peer.RunAsStandard(ctx, r.network, r.game, i, agents, numAgents)
+				return
+			}
+			agent, err := peer.StartAgent(ctx, r.game, i, agents)
+			if err != nil {
+				fmt.Fprintln(r.progress, agents[i].USER+":", err)
+				return
+			}
+			experts[i] = agent
+			outcome, err := agent.Play(ctx, numAgents, peer.DefaultTimeouts)
+			if err != nil {
+				fmt.Fprintln(r.progress, err)
+			}
+			outcomes[i] = outcome
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		// agents keep voting until every agent is done
+		for _, agent := range experts {
+			if agent != nil {
+				agent.Stop()
+			}
+		}
+		close(done)
+	}()
+	return outcomes, nil
+}
+
+// `apply` applies an event to the game and records it
+func (r *scenarioRun) apply(event reader.ScenarioEvent) error {
+	var agents []string
+	switch event.TYPE {
+	case reader.EventJoin:
+		if err := r.addGroup(event.GROUP); err != nil {
+			return err
+		}
+		agents = r.members[event.GROUP]
+	case reader.EventKill:
+		agents = r.targets(event)
+		for _, agent := range agents {
+			if err := peer.KillAgent(r.game, agent); err != nil {
+				return err
+			}
+		}
+	case reader.EventCrash:
+		agents = r.targets(event)
+		for _, agent := range agents {
+			r.crashed[agent] = true
+			if r.network != nil {
+				r.network.Crash(agent)
+			}
+		}
+	case reader.EventPartition:
+		r.partition = event.SIDES
+		for _, side := range r.sides() {
+			agents = append(agents, side...)
+		}
+		if r.network != nil {
+			r.network.Partition(r.sides())
+		}
+	case reader.EventHeal:
+		r.partition = nil
+		if r.network != nil {
+			r.network.Heal()
+		}
+	}
+
+	fmt.Fprintln(r.progress, event.AT, event.TYPE, agents)
+	r.events = append(r.events, reader.EventRecord{AT: event.AT, TYPE: event.TYPE, AGENTS: agents})
+	return nil
+}
+
+// `sides` resolves the groups of the current partition to their
+// agents. Groups joining after the partition are placed on their side.
+func (r *scenarioRun) sides() [][]string {
+	var sides [][]string
+	for _, groups := range r.partition {
+		var side []string
+		for _, group := range groups {
+			side = append(side, r.members[group]...)
+		}
+		sides = append(sides, side)
+	}
+	return sides
+}
+
+// `targets` resolves the agents a kill or crash event targets
+func (r *scenarioRun) targets(event reader.ScenarioEvent) []string {
+	if len(event.AGENTS) > 0 {
+		return event.AGENTS
+	}
+	members := r.members[event.GROUP]
+	if event.COUNT > 0 && event.COUNT < len(members) {
+		return members[:event.COUNT]
+	}
+	return members
+}
+
+// `addGroup` adds the agents of a group to the game
+func (r *scenarioRun) addGroup(name string) error {
+	var group reader.AgentGroup
+	for _, g := range r.scenario.GROUPS {
+		if g.NAME == name {
+			group = g
+		}
+	}
+
+	s := r.scenario
+	role := reader.RoleStandard
+	if s.PROTOCOL == reader.ProtocolExpert {
+		role = reader.RoleExpert
+	}
+	// scenarios play with int values
+	agents, err := reader.AddAgents(s.CONFIG, reader.IntValue(s.VALUE), group.COUNT, group.TRANSPORT, role, r.ports, func(i int) (reader.Value, bool) {
+		switch group.HONESTY {
+		case reader.HonestyLiar:
+			return reader.IntValue(group.VALUE), true
+		case reader.HonestyRandom:
+			// any value up to max-value except the true one
+			value := reader.RandomIntn(s.MAXVALUE)
+			if value >= s.VALUE {
+				value++
+			}
+			return reader.IntValue(value), true
+		}
+		return reader.IntValue(s.VALUE), false
+	})
+	if err != nil {
+		return err
+	}
+	for _, agent := range agents {
+		r.members[name] = append(r.members[name], agent.USER)
+	}
+	return nil
+}
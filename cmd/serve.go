@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"liarslie/game"
+	"liarslie/peer"
+	"liarslie/reader"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(serve)
+	serve.PersistentFlags().String("addr", "localhost:8080", "Address the REST API listens on")
+}
+
+var serve = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API for driving games",
+	Long: `This command serves a JSON REST API to create and extend games, kill agents, play rounds and fetch
+results and history. The events of the rounds it plays are streamed as server-sent events on /events
+and /games/<game>/events. The OpenAPI document of the API is served on /openapi.json.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		api := &restAPI{closing: make(chan struct{})}
+
+		// rounds in progress are abandoned on Ctrl-C, as their
+		// requests share the context of the server
+		ctx, stop := interruptContext()
+		defer stop()
+		server := &http.Server{
+			Addr:        addr,
+			Handler:     api,
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		go func() {
+			<-ctx.Done()
+			// end the event streams, which would hold up the shutdown
+			close(api.closing)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		fmt.Println("****************************************************")
+		fmt.Println("Serving the liarslie API on", addr)
+		fmt.Println("****************************************************")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(err)
+			return
+		}
+		// wait for the requests in progress before releasing the vaults
+		api.mu.Lock()
+		reader.CloseVaults()
+		api.mu.Unlock()
+		fmt.Println("The liarslie API has shut down")
+	},
+}
+
+// createGameRequest creates a game of standard agents, like `start`.
+// The game is kept in the agents config given by --agents: clients
+// do not choose files of the server.
+type createGameRequest struct {
+	game.Params
+	// SEED drives the random choices of the game, zero keeps the
+	// current seed
+	SEED int64
+	// VALUES describes the values of the game, default int values
+	// decided by mode
+	VALUES reader.ValueSpec
+}
+
+// extendGameRequest adds expert agents and plays a round, like `extend`
+type extendGameRequest struct {
+	game.Params
+	SEED int64
+}
+
+// playRequest plays a round in MODE standard or expert. An expert
+// round is played by every agent of the game, the expert agents
+// running as daemons and the others in the server process.
+type playRequest struct {
+	MODE string
+}
+
+// gameResponse describes a game and its agents
+type gameResponse struct {
+	GAMEID string
+	CONFIG string
+	SEED   int64
+	VALUES reader.ValueSpec
+	AGENTS []reader.ParticipantSet
+}
+
+// errorResponse carries the error of a failed request
+type errorResponse struct {
+	ERROR string
+}
+
+// eventStream is returned by handlers that stream the events of
+// GAME, or of every game if GAME is empty, instead of responding
+type eventStream struct {
+	GAME string
+}
+
+// apiError is an error with the HTTP status it is reported with
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e apiError) Error() string {
+	return e.err.Error()
+}
+
+// `statusError` reports `err` with HTTP status `status`
+func statusError(status int, format string, args ...interface{}) error {
+	return apiError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// route is an endpoint of the REST API. Its request and response
+// are examples of the types it reads and writes, from which the
+// OpenAPI document is generated.
+type route struct {
+	method   string
+	path     string
+	summary  string
+	status   int
+	request  interface{}
+	response interface{}
+	handle   func(api *restAPI, r *http.Request, params map[string]string) (interface{}, error)
+}
+
+// routes of the REST API. Path segments in braces are parameters.
+// They are set by `init`, as the OpenAPI document is generated
+// from them.
+var routes []route
+
+func init() {
+	routes = []route{
+		{http.MethodGet, "/games", "List the games", http.StatusOK, nil, []reader.GameEntry{}, (*restAPI).listGames},
+		{http.MethodPost, "/games", "Create a game of standard agents, like start", http.StatusCreated, createGameRequest{}, gameResponse{}, (*restAPI).createGame},
+		{http.MethodGet, "/games/{game}", "Describe a game and its agents", http.StatusOK, nil, gameResponse{}, (*restAPI).getGame},
+		{http.MethodDelete, "/games/{game}", "Stop a game and remove it, like stop", http.StatusNoContent, nil, nil, (*restAPI).stopGame},
+		{http.MethodPost, "/games/{game}/agents", "Add expert agents and play a round, like extend", http.StatusOK, extendGameRequest{}, reader.GameResult{}, (*restAPI).extendGame},
+		{http.MethodDelete, "/games/{game}/agents/{agent}", "Remove an agent from the network, like kill", http.StatusNoContent, nil, nil, (*restAPI).killAgent},
+		{http.MethodPost, "/games/{game}/play", "Play a round, like play or playexpert", http.StatusOK, playRequest{}, reader.GameResult{}, (*restAPI).play},
+		{http.MethodGet, "/games/{game}/results", "Result of the last round", http.StatusOK, nil, reader.GameResult{}, (*restAPI).results},
+		{http.MethodGet, "/games/{game}/history", "Every round recorded for the game", http.StatusOK, nil, []reader.RoundRecord{}, (*restAPI).history},
+		{http.MethodGet, "/games/{game}/events", "Stream the events of the game", http.StatusOK, nil, eventStream{}, (*restAPI).gameEvents},
+		{http.MethodGet, "/events", "Stream the events of every game", http.StatusOK, nil, eventStream{}, (*restAPI).events},
+		{http.MethodGet, "/openapi.json", "This document", http.StatusOK, nil, nil, (*restAPI).openAPI},
+	}
+}
+
+// restAPI serves the routes. Games share the vaults and the seed
+// of the process, so requests are handled one at a time.
+type restAPI struct {
+	mu sync.Mutex
+	// closing is closed when the server shuts down
+	closing chan struct{}
+}
+
+func (api *restAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, params, err := matchRoute(r.Method, r.URL.Path)
+	if err == nil {
+		api.mu.Lock()
+		var resp interface{}
+		resp, err = rt.handle(api, r, params)
+		api.mu.Unlock()
+		if stream, ok := resp.(eventStream); ok && err == nil {
+			// streams run outside the lock, alongside the rounds
+			fmt.Println(r.Method, r.URL.Path, "streaming")
+			peer.ServeEvents(w, r, stream.GAME, api.closing)
+			return
+		}
+		if err == nil {
+			writeAPIResponse(w, rt.status, resp)
+			fmt.Println(r.Method, r.URL.Path, rt.status)
+			return
+		}
+	}
+
+	status := http.StatusInternalServerError
+	var failure apiError
+	if errors.As(err, &failure) {
+		status = failure.status
+	} else if errors.Is(err, game.ErrNoGame) || errors.Is(err, game.ErrNoAgent) || errors.Is(err, game.ErrNoRounds) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, peer.ErrNoPeers) || errors.Is(err, peer.ErrQuorumNotReached) || errors.Is(err, peer.ErrTimeout) {
+		status = http.StatusGatewayTimeout
+	} else if errors.Is(err, peer.ErrAgentStopped) {
+		status = http.StatusServiceUnavailable
+	}
+	writeAPIResponse(w, status, errorResponse{ERROR: err.Error()})
+	fmt.Println(r.Method, r.URL.Path, status, err)
+}
+
+// `matchRoute` finds the route of a request and its path parameters
+func matchRoute(method string, path string) (route, map[string]string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	pathFound := false
+	for _, rt := range routes {
+		params, ok := matchPath(rt.path, segments)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if rt.method == method {
+			return rt, params, nil
+		}
+	}
+	if pathFound {
+		return route{}, nil, statusError(http.StatusMethodNotAllowed, "%s %s is not supported", method, path)
+	}
+	return route{}, nil, statusError(http.StatusNotFound, "%s not found", path)
+}
+
+// `matchPath` matches the segments of a path against `pattern`
+func matchPath(pattern string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[strings.Trim(part, "{}")] = segments[i]
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// `writeAPIResponse` writes `v` as the JSON response of a request
+func writeAPIResponse(w http.ResponseWriter, status int, v interface{}) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// `decodeRequest` reads the JSON body of a request into `v`.
+// An empty body leaves `v` at its defaults.
+func decodeRequest(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return statusError(http.StatusBadRequest, "invalid request: %v", err)
+	}
+	return nil
+}
+
+// `describeGame` describes game `g`
+func describeGame(g *game.Game) (gameResponse, error) {
+	agents, err := g.Agents()
+	if err != nil {
+		return gameResponse{}, err
+	}
+	values, err := g.Values()
+	if err != nil {
+		return gameResponse{}, err
+	}
+	return gameResponse{GAMEID: g.ID(), CONFIG: g.Config(), SEED: reader.Seed(), VALUES: values, AGENTS: agents}, nil
+}
+
+func (api *restAPI) listGames(r *http.Request, params map[string]string) (interface{}, error) {
+	games, err := reader.ListGames()
+	if games == nil {
+		games = []reader.GameEntry{}
+	}
+	return games, err
+}
+
+func (api *restAPI) createGame(r *http.Request, params map[string]string) (interface{}, error) {
+	var req createGameRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	// the agents of a cluster would be restarted by its supervisor
+	if previous := reader.GetGameID(agentsConfig); previous != "" {
+		stopCluster(previous)
+	}
+	g, err := game.New(game.Options{Params: req.Params, CONFIG: agentsConfig, SEED: req.SEED, VALUES: req.VALUES})
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest, "%v", err)
+	}
+	return describeGame(g)
+}
+
+func (api *restAPI) getGame(r *http.Request, params map[string]string) (interface{}, error) {
+	g, err := game.Find(params["game"])
+	if err != nil {
+		return nil, err
+	}
+	return describeGame(g)
+}
+
+func (api *restAPI) stopGame(r *http.Request, params map[string]string) (interface{}, error) {
+	g, err := game.Find(params["game"])
+	if err != nil {
+		return nil, err
+	}
+	return nil, resetGame(g.Config())
+}
+
+func (api *restAPI) extendGame(r *http.Request, params map[string]string) (interface{}, error) {
+	g, err := game.Find(params["game"])
+	if err != nil {
+		return nil, err
+	}
+	var req extendGameRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if req.SEED != 0 {
+		reader.SetSeed(req.SEED)
+	}
+	if err := g.AddAgents(req.Params); err != nil {
+		return nil, statusError(http.StatusBadRequest, "%v", err)
+	}
+	return g.Play(r.Context(), game.ModeExpert)
+}
+
+func (api *restAPI) killAgent(r *http.Request, params map[string]string) (interface{}, error) {
+	g, err := game.Find(params["game"])
+	if err != nil {
+		return nil, err
+	}
+	return nil, g.Kill(params["agent"])
+}
+
+func (api *restAPI) play(r *http.Request, params map[string]string) (interface{}, error) {
+	g, err := game.Find(params["game"])
+	if err != nil {
+		return nil, err
+	}
+	var req playRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	switch req.MODE {
+	case game.ModeStandard, "":
+		return g.Play(r.Context(), game.ModeStandard)
+	case game.ModeExpert:
+		return g.Play(r.Context(), game.ModeExpert)
+	}
+	return nil, statusError(http.StatusBadRequest, "unknown mode %q", req.MODE)
+}
+
+// results and history come from the ledger, which outlives the game
+
+func (api *restAPI) results(r *http.Request, params map[string]string) (interface{}, error) {
+	if err := reader.ValidGameID(params["game"]); err != nil {
+		return nil, statusError(http.StatusNotFound, "%v", err)
+	}
+	records, err := reader.ReadLedger(params["game"])
+	if err != nil || len(records) == 0 {
+		return nil, statusError(http.StatusNotFound, "no rounds played in game %s", params["game"])
+	}
+	return reader.ResultOfRound(records[len(records)-1]), nil
+}
+
+func (api *restAPI) history(r *http.Request, params map[string]string) (interface{}, error) {
+	if err := reader.ValidGameID(params["game"]); err != nil {
+		return nil, statusError(http.StatusNotFound, "%v", err)
+	}
+	records, err := reader.ReadLedger(params["game"])
+	if err != nil {
+		return nil, statusError(http.StatusNotFound, "no history for game %s", params["game"])
+	}
+	return records, nil
+}
+
+func (api *restAPI) gameEvents(r *http.Request, params map[string]string) (interface{}, error) {
+	if _, err := game.Find(params["game"]); err != nil {
+		return nil, err
+	}
+	return eventStream{GAME: params["game"]}, nil
+}
+
+func (api *restAPI) events(r *http.Request, params map[string]string) (interface{}, error) {
+	return eventStream{}, nil
+}
+
+func (api *restAPI) openAPI(r *http.Request, params map[string]string) (interface{}, error) {
+	return openAPIDocument(routes), nil
+}
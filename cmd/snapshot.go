@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"liarslie/game"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(snapshot)
+	snapshot.AddCommand(snapshotSave)
+	snapshot.AddCommand(snapshotRestore)
+}
+
+var snapshot = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and restore the state of a game",
+	Long:  `This command freezes a game into a single versioned archive and restores it later, possibly on another machine.`,
+}
+
+var snapshotSave = &cobra.Command{
+	Use:   "save <file>",
+	Short: "save the current game to an archive",
+	Long:  `This command bundles the agents config, agent keys, vault contents, ground truth and ledger of a game into one archive.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		g, err := game.Open(agentsConfig)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := g.Save(args[0]); err != nil {
+			fmt.Println("Error in saving snapshot:", err)
+			return
+		}
+		fmt.Println("Game", g.ID(), "saved to", args[0])
+	},
+}
+
+var snapshotRestore = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "restore a game from an archive",
+	Long:  `This command verifies the integrity of an archive and restores the game it holds into the agents config.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		g, err := game.Restore(args[0], agentsConfig)
+		if err != nil {
+			fmt.Println("Error in restoring snapshot:", err)
+			return
+		}
+		fmt.Println("Game", g.ID(), "restored into", agentsConfig)
+	},
+}
@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"liarslie/peer"
+	"io"
+	"liarslie/game"
 	"liarslie/reader"
-	"os"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -16,10 +18,22 @@ func init() {
 	standard.AddCommand(start)
 	standard.AddCommand(play)
 	standard.AddCommand(stop)
+	standard.AddCommand(list)
 	start.PersistentFlags().String("value", "", "True value of the network")
 	start.PersistentFlags().String("max-value", "", "Max value that a liar can broadcast")
 	start.PersistentFlags().String("num-agents", "", "Total number of agents in the network")
 	start.PersistentFlags().String("liar-ratio", "", "Ratio between liars and truth-tellers in the network")
+	start.PersistentFlags().String("liar-value", "", "Value that liars broadcast (default is max-value * liar-ratio, required for non-numeric values)")
+	start.PersistentFlags().String("value-type", string(reader.TypeInt), "Type of the values: int, float, string, bytes or struct")
+	start.PersistentFlags().String("aggregation", "", "Rule agents decide with: mode, median, trimmed-mean or exact (default depends on the value type)")
+	addKeysFlags(start)
+	start.PersistentFlags().String("transport", reader.TransportTCP, "Transport agents listen on: tcp, quic, ws or mixed")
+	start.PersistentFlags().String("port-range", reader.DefaultPortRange.String(), "Range of ports agents listen on, as min-max")
+
+	addOutputFlag(play)
+	addRoundsFlags(play)
+
+	stop.PersistentFlags().String("game", "", "Id of the game to stop (default is the game in --agents)")
 }
 
 var standard = &cobra.Command{
@@ -42,31 +56,63 @@ var start = &cobra.Command{
 		value, _ := cmd.Flags().GetString("value")
 		maxValue, _ := cmd.Flags().GetString("max-value")
 		liarRatio, _ := cmd.Flags().GetString("liar-ratio")
+		liarValue, _ := cmd.Flags().GetString("liar-value")
+		valueType, _ := cmd.Flags().GetString("value-type")
+		aggregation, _ := cmd.Flags().GetString("aggregation")
+		transport, _ := cmd.Flags().GetString("transport")
+		portRange, _ := cmd.Flags().GetString("port-range")
+
+		keys, err := readKeys(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
-		// preliminary setup
-		val, valConversionError := strconv.Atoi(value)
+		// preliminary setup; the values are parsed by their type
 		agents, agentConversionError := strconv.Atoi(num)
-		max, maxConversionError := strconv.Atoi(maxValue)
+		max, maxConversionError := readMaxValue(maxValue, liarValue != "" || len(keys) > 0 || !reader.ValueType(valueType).Numeric())
 		ratio, liarRatioConversionError := strconv.ParseFloat(liarRatio, 32)
-		config := "agents.json"
-
-		// remove config if exists
-		os.Remove(config)
-		// remove storage
-		os.RemoveAll("storage/")
 
-		if valConversionError != nil || agentConversionError != nil || maxConversionError != nil || liarRatioConversionError != nil {
+		if (value == "") == (len(keys) == 0) || agentConversionError != nil || maxConversionError != nil || liarRatioConversionError != nil {
 			fmt.Println("Error in value conversion.")
 			return
 		}
 
-		// call append file from reader.go to generate config
-		appendError := reader.AddAgentsToConfig(agents, val, max, ratio, config)
-		if appendError != nil {
-			fmt.Println("Error in saving agents.json.")
+		// the agents of a cluster would be restarted by its supervisor
+		if previous := reader.GetGameID(agentsConfig); previous != "" {
+			stopCluster(previous)
+		}
+		g, err := game.New(game.Options{
+			CONFIG: agentsConfig,
+			VALUES: reader.ValueSpec{TYPE: reader.ValueType(valueType), AGGREGATION: reader.Aggregation(aggregation)},
+			Params: game.Params{
+				VALUE:     reader.Value(value),
+				LIE:       reader.Value(liarValue),
+				KEYS:      keys,
+				MAXVALUE:  max,
+				AGENTS:    agents,
+				RATIO:     ratio,
+				TRANSPORT: transport,
+				PORTRANGE: portRange,
+			},
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		values, err := g.Values()
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
-		fmt.Println("Ready...")
+		fmt.Println("Game", g.ID(), "is ready...")
+		if !values.IsDefault() {
+			fmt.Println("Values:", values.TYPE, "decided by", values.AGGREGATION)
+			if len(values.KEYS) > 0 {
+				fmt.Println("Keys:", strings.Join(values.KEYS, ", "))
+			}
+		}
+		fmt.Println("Seed:", reader.Seed())
 	},
 }
 
@@ -75,45 +121,53 @@ var play = &cobra.Command{
 	Short: "Start computing the true network value",
 	Long:  `This command starts p2p networking among the agents and computes the true network value`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("********************************************************************************************")
-		fmt.Println("Starting liarslie in standard mode... Attempting to compute network value for only one round")
-		fmt.Println("********************************************************************************************")
-
-		// get agents from config
-		agents := reader.GetCurrentParticipants("agents.json")
-		numAgents := len(agents)
-
-		var wg sync.WaitGroup
-		wg.Add(numAgents)
-		// initialize network value as -1
-		truthValue := -1
-		// start standard mode network value computation
-		for i := 0; i < numAgents; i++ {
-			go func(i int, agents []reader.ParticipantSet) {
-				defer wg.Done()
-				value, _ := strconv.Atoi(peer.RunAsStandard(i, agents, numAgents))
-				if truthValue < value {
-					truthValue = value
-				}
-			}(i, agents)
-		}
-
-		wg.Wait()
-
-		if truthValue < 0 {
-			fmt.Println(" ")
-			fmt.Println("*******************************************")
-			fmt.Println("Please check your agents config. Its empty!")
-			fmt.Println("*******************************************")
-		} else {
-			fmt.Println(" ")
-			fmt.Println("*****************************************")
-			fmt.Println("The computed network value is", truthValue)
-			fmt.Println("*****************************************")
+		format, out, progress, err := beginOutput(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		rounds, schedule, err := readRoundsFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
 		}
 
-		fmt.Println(" ")
-		fmt.Println("One round of play in standard mode is complete.. Liarslie is shutting down..")
+		g, err := game.Open(agentsConfig)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
+		}
+		defer pushEvents(g.ID())()
+		trail, _ := cmd.Flags().GetBool("liars-trail")
+		g.SetLiarsTrail(trail)
+		ctx, stop := interruptContext()
+		defer stop()
+		if rounds > 1 || cmd.Flags().Changed("truth") {
+			fmt.Fprintln(progress, "********************************************************************************************")
+			fmt.Fprintln(progress, "Starting liarslie in standard mode... Attempting to compute network value for", rounds, "rounds")
+			fmt.Fprintln(progress, "********************************************************************************************")
+			fmt.Fprintln(progress, "Seed:", reader.Seed())
+			playRounds(ctx, g, game.ModeStandard, rounds, schedule, format, out, progress)
+			return
+		}
+
+		fmt.Fprintln(progress, "********************************************************************************************")
+		fmt.Fprintln(progress, "Starting liarslie in standard mode... Attempting to compute network value for only one round")
+		fmt.Fprintln(progress, "********************************************************************************************")
+		fmt.Fprintln(progress, "Seed:", reader.Seed())
+
+		result, err := g.Play(ctx, game.ModeStandard)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			return
+		}
+		if err := writeResult(out, format, result); err != nil {
+			fmt.Fprintln(progress, "Error in writing the result:", err)
+			return
+		}
+
+		fmt.Fprintln(progress, " ")
+		fmt.Fprintln(progress, "One round of play in standard mode is complete.. Liarslie is shutting down..")
 
 	},
 }
@@ -121,22 +175,27 @@ var play = &cobra.Command{
 var stop = &cobra.Command{
 	Use:   "stop",
 	Short: "stop liarslie",
-	Long:  `This command can be used to stop the game`,
+	Long:  `This command can be used to stop the game. Other games running on the machine are left untouched.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := cmd.Flags().GetString("game")
+		config := agentsConfig
+		if id != "" {
+			entry, ok := reader.FindGame(id)
+			if !ok {
+				fmt.Println("No game by id provided exists")
+				return
+			}
+			config = entry.CONFIG
+		}
+
 		fmt.Println(" ")
 		fmt.Println("*********************************************************")
 		fmt.Println("All artifacts from liarslie are being succesfully removed")
 		fmt.Println("*********************************************************")
 
-		err := os.Remove("agents.json")
-		if err != nil {
+		if err := resetGame(config); err != nil {
 			fmt.Println(err)
 		}
-		os.RemoveAll("storage/")
-		e := KillProcess("liarslie")
-		if e != nil {
-			fmt.Println(e)
-		}
 
 		fmt.Println(" ")
 		fmt.Println("*****************************")
@@ -144,3 +203,83 @@ var stop = &cobra.Command{
 		fmt.Println("*****************************")
 	},
 }
+
+var list = &cobra.Command{
+	Use:   "list",
+	Short: "list liarslie games",
+	Long:  `This command lists the games started on this machine together with their agents config`,
+	Run: func(cmd *cobra.Command, args []string) {
+		games, err := reader.ListGames()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if len(games) == 0 {
+			fmt.Println("No games are running")
+			return
+		}
+		for _, entry := range games {
+			agents, _ := reader.GetCurrentParticipants(entry.CONFIG)
+			fmt.Println(entry.GAMEID, entry.CONFIG, len(agents), "agents", "started", entry.CREATED.Format(time.RFC3339))
+		}
+	},
+}
+
+// `playRounds` plays `rounds` rounds of game `g` in mode `mode`,
+// changing the truth as `schedule` decides, and writes how closely
+// the network tracked it to `out` and its progress to `progress`
+func playRounds(ctx context.Context, g *game.Game, mode string, rounds int, schedule game.TruthSchedule, format string, out io.Writer, progress io.Writer) {
+	tracking, err := g.PlayRounds(ctx, mode, rounds, schedule)
+	if err != nil {
+		fmt.Fprintln(progress, err)
+	}
+	if len(tracking.ROUNDS) == 0 {
+		return
+	}
+	if err := writeTracking(out, format, tracking); err != nil {
+		fmt.Fprintln(progress, "Error in writing the result:", err)
+		return
+	}
+
+	fmt.Fprintln(progress, " ")
+	fmt.Fprintln(progress, len(tracking.ROUNDS), "rounds of play in", mode, "mode are complete.. Liarslie is shutting down..")
+}
+
+// `readMaxValue` parses --max-value, which is `optional` if the
+// liars are given a value with --liar-value or keys, or the values
+// are not numbers. Keys check that they have something to lie with
+// when the agents are added.
+func readMaxValue(maxValue string, optional bool) (int, error) {
+	if maxValue == "" && optional {
+		return 0, nil
+	}
+	return strconv.Atoi(maxValue)
+}
+
+// `addKeysFlags` adds `--key` and `--keys` to a command adding agents
+func addKeysFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringArray("key", nil, "Key of a game of keys, as NAME=VALUE, NAME=VALUE@LIE or NAME=VALUE@LOW..HIGH; repeat for every key")
+	cmd.PersistentFlags().String("keys", "", "JSON file listing the keys of a game of keys, instead of --key")
+}
+
+// `readKeys` reads the keys given with `--key` and `--keys`, nil for
+// a game of a single value
+func readKeys(cmd *cobra.Command) ([]reader.KeySpec, error) {
+	specs, _ := cmd.Flags().GetStringArray("key")
+	file, _ := cmd.Flags().GetString("keys")
+	var keys []reader.KeySpec
+	if file != "" {
+		var err error
+		if keys, err = reader.ReadKeysFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range specs {
+		key, err := reader.ParseKeySpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"liarslie/reader"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backoff between restarts of an agent. An agent that ran for
+// healthyAfter starts again from minBackoff.
+const (
+	minBackoff   = time.Second
+	maxBackoff   = 30 * time.Second
+	healthyAfter = time.Minute
+)
+
+// supervisor runs one process per agent of a game and restarts the
+// agents that exit until it is told to stop
+type supervisor struct {
+	game   string
+	agents []reader.ParticipantSet
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	state clusterState
+}
+
+// `newSupervisor` prepares the supervision of the agents in `config`
+func newSupervisor(config string) (*supervisor, error) {
+	game := reader.GetGameID(config)
+	agents, err := reader.GetCurrentParticipants(config)
+	if err != nil {
+		return nil, err
+	}
+	if game == "" {
+		return nil, fmt.Errorf("no game in %s", config)
+	}
+	return &supervisor{
+		game:   game,
+		agents: agents,
+		stop:   make(chan struct{}),
+		state:  clusterState{SUPERVISOR: os.Getpid(), AGENTS: make(map[string]agentProcess)},
+	}, nil
+}
+
+// `run` supervises the agents until the supervisor receives SIGINT
+// or SIGTERM, then shuts the agents down
+func (s *supervisor) run() {
+	if err := os.MkdirAll(reader.RunDir(s.game), 0755); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := writePIDFile(s.game, supervisorPIDFile, os.Getpid()); err != nil {
+		fmt.Println(err)
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	fmt.Println("Supervising", len(s.agents), "agents of game", s.game)
+	for _, agent := range s.agents {
+		s.wg.Add(1)
+		go s.supervise(agent.USER)
+	}
+
+	sig := <-signals
+	fmt.Println("Received", sig, "- shutting the agents down")
+	close(s.stop)
+	// agents are asked to shut down first, so that they release
+	// their vault; those that do not answer are terminated
+	shutdownAgents(s.game, s.agents)
+	for _, agent := range s.agents {
+		if pid, ok := readPIDFile(s.game, agent.USER+".pid"); ok && isOwnProcess(pid, "--name", agent.USER) {
+			terminate(pid, 5*time.Second)
+		}
+	}
+	s.wg.Wait()
+
+	os.Remove(filepath.Join(reader.RunDir(s.game), clusterStateFile))
+	os.Remove(filepath.Join(reader.RunDir(s.game), supervisorPIDFile))
+	fmt.Println("Supervisor of game", s.game, "has stopped")
+}
+
+// `supervise` runs agent `user` and restarts it with an increasing
+// backoff whenever it exits, until the supervisor stops
+func (s *supervisor) supervise(user string) {
+	defer s.wg.Done()
+	backoff := minBackoff
+	for restarts := 0; ; restarts++ {
+		started := time.Now()
+		err := s.runAgent(user, restarts)
+		if s.stopping() {
+			return
+		}
+		if time.Since(started) > healthyAfter {
+			backoff = minBackoff
+		}
+		fmt.Println(user, "exited:", err, "- restarting in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// `runAgent` runs agent `user` in its own process, logging to
+// run/<game>/<user>.log, and waits for it to exit
+func (s *supervisor) runAgent(user string, restarts int) error {
+	logFile, err := os.OpenFile(filepath.Join(reader.RunDir(s.game), user+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd, err := selfCommand("agent", "run", "--name", user)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pidFile := user + ".pid"
+	if err := writePIDFile(s.game, pidFile, cmd.Process.Pid); err != nil {
+		fmt.Println(err)
+	}
+	s.record(user, agentProcess{PID: cmd.Process.Pid, STARTED: time.Now(), RESTARTS: restarts})
+	fmt.Println(user, "started with pid", cmd.Process.Pid)
+
+	err = cmd.Wait()
+	os.Remove(filepath.Join(reader.RunDir(s.game), pidFile))
+	return err
+}
+
+// `stopping` reports whether the supervisor was told to stop
+func (s *supervisor) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// `record` stores the process of agent `user` in the cluster state
+func (s *supervisor) record(user string, proc agentProcess) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.AGENTS[user] = proc
+	dataBytes, err := json.MarshalIndent(s.state, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(reader.RunDir(s.game), clusterStateFile), dataBytes, 0644)
+	}
+	if err != nil {
+		fmt.Println("Error in recording the cluster state:", err)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// version of liarslie
+const version = "0.0.1"
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
@@ -15,6 +18,6 @@ var versionCmd = &cobra.Command{
 	Short: "Print current version of liarslie",
 	Long:  `This command can be used get the version number of liarslie`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("liarslie v0.0.1")
+		fmt.Println("liarslie v" + version)
 	},
 }
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"liarslie/peer"
+	"liarslie/reader"
+	"net/http"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(watch)
+	watch.PersistentFlags().String("addr", "", "Address of a `serve` process to follow (default is the running agent daemons)")
+	watch.PersistentFlags().Bool("json", false, "Print the events as JSON lines")
+}
+
+var watch = &cobra.Command{
+	Use:   "watch",
+	Short: "Follow the events of a game as they happen",
+	Long: `This command follows the events of the game in --agents: peers connecting, messages sent and received,
+votes counted, values decided and injected faults. Events are streamed by the process that plays the
+round, so watch follows either a serve process given with --addr, or the running agent daemons and the
+commands playing rounds of the game, such as play, extend and playexpert, until it is interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		game := reader.GetGameID(agentsConfig)
+		agents, err := reader.GetCurrentParticipants(agentsConfig)
+		if game == "" || err != nil {
+			fmt.Println("No game found in", agentsConfig)
+			return
+		}
+
+		// peer IDs are shown by the name of their agent
+		names := make(map[string]string)
+		for _, participant := range agents {
+			if participant.PEERID != "" {
+				names[participant.PEERID] = participant.USER
+			}
+		}
+		var mu sync.Mutex
+		show := func(event peer.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			printEvent(event, names, asJSON)
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		if addr != "" {
+			url := "http://" + addr + "/games/" + game + "/events"
+			fmt.Println("Watching", url)
+			if err := peer.WatchEvents(ctx, http.DefaultClient, url, show); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+
+		clients := make(map[string]*peer.ControlClient)
+		for _, participant := range agents {
+			if client := dialAgent(game, participant.USER); client != nil {
+				defer client.Close()
+				clients[participant.USER] = client
+			}
+		}
+
+		fmt.Println("Watching game", game+":", len(clients), "agent daemons and the rounds played by commands such as play and extend")
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := peer.ListenEvents(ctx, game, show); err != nil {
+				fmt.Println(err)
+			}
+		}()
+		for user, client := range clients {
+			wg.Add(1)
+			go func(user string, client *peer.ControlClient) {
+				defer wg.Done()
+				if err := client.Events(ctx, show); err != nil {
+					fmt.Println(user+":", err)
+				}
+			}(user, client)
+		}
+		wg.Wait()
+	},
+}
+
+// `printEvent` prints `event` on one line, naming peers after their
+// agent where `names` knows them
+func printEvent(event peer.Event, names map[string]string, asJSON bool) {
+	if name, ok := names[event.PEER]; ok {
+		event.PEER = name
+	}
+	if asJSON {
+		data, _ := json.Marshal(event)
+		fmt.Println(string(data))
+		return
+	}
+	line := fmt.Sprintf("%s %-16s %-12s", event.TIME.Format("15:04:05.000"), event.TYPE, event.AGENT)
+	if event.PEER != "" {
+		line += " peer " + event.PEER
+	}
+	if event.VALUE != "" {
+		line += " value " + event.VALUE
+	}
+	if event.DETAIL != "" {
+		line += " " + event.DETAIL
+	}
+	fmt.Println(line)
+}
+
+// `pushEvents` pushes the events of game `game` published by this
+// command to the watchers of the game until the returned function is
+// called
+func pushEvents(game string) func() {
+	if game == "" {
+		return func() {}
+	}
+	return peer.PushEvents(game)
+}
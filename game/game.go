@@ -0,0 +1,427 @@
+// Package game runs liarslie games from Go code. It is what the
+// commands of the CLI are built on:
+//
+//	g, err := game.New(game.Options{CONFIG: "agents.json", Params: game.Params{VALUE: "5", MAXVALUE: 8, AGENTS: 10, RATIO: 0.2}})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := g.Play(ctx, game.ModeStandard)
+//
+// Games keep their state in the agents config, vaults and ledger of
+// the working directory, like the CLI. The vaults and the seed are
+// shared by the process, so a process plays one round at a time.
+package game
+
+import (
+	"errors"
+	"fmt"
+	"liarslie/peer"
+	"liarslie/reader"
+	"os"
+	"strconv"
+)
+
+// modes a round can be played in
+const (
+	ModeStandard = reader.RoleStandard
+	ModeExpert   = reader.RoleExpert
+)
+
+var (
+	// ErrNoGame is returned when no game is played with a config
+	ErrNoGame = errors.New("no such game")
+	// ErrNoAgent is returned for agents that are not part of a game
+	ErrNoAgent = errors.New("no such agent")
+	// ErrNoRounds is returned for results of a game without rounds
+	ErrNoRounds = errors.New("no rounds played")
+)
+
+// Params describe the agents added to a game by `New` and
+// `AddAgents`
+type Params struct {
+	// VALUE is the true value, parsed as a value of the game
+	VALUE reader.Value `json:",omitempty"`
+	// LIE is the value liars observe. Games of numbers default to
+	// MAXVALUE * RATIO, other games need it if they have liars.
+	LIE reader.Value `json:",omitempty"`
+	// KEYS make a game of keys instead of a game of VALUE. Agents
+	// added to a game of keys need a true value for each of its keys.
+	KEYS []reader.KeySpec `json:",omitempty"`
+	// MAXVALUE bounds the numbers liars draw for keys without a lie
+	// or a range, which need it
+	MAXVALUE  int
+	AGENTS    int
+	RATIO     float64
+	TRANSPORT string
+	PORTRANGE string
+}
+
+// `validate` fills in the defaults of the parameters and checks
+// them. The values are put in the canonical encoding of `values`.
+func (p *Params) validate(values reader.ValueSpec) (reader.PortRange, error) {
+	validateValues := p.validateValue
+	if len(values.KEYS) > 0 {
+		validateValues = p.validateKeys
+	} else if len(p.KEYS) > 0 {
+		return reader.PortRange{}, fmt.Errorf("the game has a single value, keys are given when it starts")
+	}
+	if err := validateValues(values); err != nil {
+		return reader.PortRange{}, err
+	}
+	if p.TRANSPORT == "" {
+		p.TRANSPORT = reader.TransportTCP
+	}
+	if !reader.ValidTransport(p.TRANSPORT) {
+		return reader.PortRange{}, fmt.Errorf("unknown transport %s", p.TRANSPORT)
+	}
+	if p.AGENTS < 1 {
+		return reader.PortRange{}, fmt.Errorf("the number of agents must be at least 1")
+	}
+	if p.RATIO < 0 || p.RATIO > 1 {
+		return reader.PortRange{}, fmt.Errorf("the liar ratio must be between 0 and 1")
+	}
+	return reader.ParsePortRange(p.PORTRANGE)
+}
+
+// `validateValue` checks the true value and the lie of a game of a
+// single value
+func (p *Params) validateValue(values reader.ValueSpec) error {
+	value, err := values.TYPE.Canonical(string(p.VALUE))
+	if err != nil {
+		return fmt.Errorf("true value: %w", err)
+	}
+	p.VALUE = value
+	if p.LIE == "" && values.TYPE.Numeric() {
+		lie := float64(p.MAXVALUE) * p.RATIO
+		// the ratio is given with the precision of a float32
+		p.LIE = reader.Value(strconv.FormatFloat(lie, 'g', -1, 32))
+		if values.TYPE == reader.TypeInt {
+			p.LIE = reader.IntValue(int(lie))
+		}
+	}
+	if p.LIE != "" {
+		if p.LIE, err = values.TYPE.Canonical(string(p.LIE)); err != nil {
+			return fmt.Errorf("liar value: %w", err)
+		}
+	} else if p.RATIO > 0 {
+		return fmt.Errorf("liars of a game of %s values need a value to lie with", values.TYPE)
+	}
+	return nil
+}
+
+// `validateKeys` checks that the parameters give a true value for
+// every key of a game of keys and what its liars observe
+func (p *Params) validateKeys(values reader.ValueSpec) error {
+	if p.VALUE != "" || p.LIE != "" {
+		return fmt.Errorf("a game of keys takes a true value for each key instead of a single value")
+	}
+	truth := make(reader.Facts)
+	for i := range p.KEYS {
+		key := &p.KEYS[i]
+		if err := key.Validate(values.TYPE, p.MAXVALUE); err != nil {
+			return err
+		}
+		if _, ok := truth[key.KEY]; ok {
+			return fmt.Errorf("duplicate key %s", key.KEY)
+		}
+		truth[key.KEY] = key.VALUE
+	}
+	// every key of the game and no other
+	if _, err := values.Canonical(string(truth.Value())); err != nil {
+		return fmt.Errorf("true values: %w", err)
+	}
+	return nil
+}
+
+// Options describe a new game of standard agents
+type Options struct {
+	Params
+	// CONFIG is the agents config of the game, default is
+	// reader.DefaultConfig
+	CONFIG string
+	// SEED drives the random choices of the process, zero keeps
+	// the current seed
+	SEED int64
+	// VALUES describes the values of the game, default is
+	// reader.DefaultValueSpec
+	VALUES reader.ValueSpec
+}
+
+// Game is a game played with an agents config
+type Game struct {
+	id       string
+	config   string
+	timeouts peer.Timeouts
+	trail    bool
+}
+
+// `New` replaces the game played with the config of `opts` by a new
+// game of standard agents. Agents of the previous game run by a
+// cluster are restarted by its supervisor, stop it first.
+func New(opts Options) (*Game, error) {
+	if opts.CONFIG == "" {
+		opts.CONFIG = reader.DefaultConfig
+	}
+	if opts.SEED != 0 {
+		reader.SetSeed(opts.SEED)
+	}
+	Reset(opts.CONFIG)
+	if len(opts.KEYS) > 0 {
+		opts.VALUES.KEYS = reader.KeyNames(opts.KEYS)
+	}
+	if err := opts.VALUES.Validate(); err != nil {
+		return nil, err
+	}
+	ports, err := opts.validate(opts.VALUES)
+	if err != nil {
+		return nil, err
+	}
+	err = opts.addAgents(opts.VALUES, reader.RoleStandard, ports, opts.CONFIG)
+	reader.CloseVaults()
+	if err == nil {
+		err = reader.SetValueSpec(opts.CONFIG, opts.VALUES)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error in saving %s: %w", opts.CONFIG, err)
+	}
+	return Open(opts.CONFIG)
+}
+
+// `Open` returns the game played with `config`
+func Open(config string) (*Game, error) {
+	id := reader.GetGameID(config)
+	if id == "" {
+		return nil, fmt.Errorf("%w in %s", ErrNoGame, config)
+	}
+	return &Game{id: id, config: config, timeouts: peer.DefaultTimeouts}, nil
+}
+
+// `Find` returns the game with ID `id` among the games started on
+// this machine
+func Find(id string) (*Game, error) {
+	entry, ok := reader.FindGame(id)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoGame, id)
+	}
+	return &Game{id: id, config: entry.CONFIG, timeouts: peer.DefaultTimeouts}, nil
+}
+
+// `SetTimeouts` bounds the phases of the expert rounds of the game,
+// which default to `peer.DefaultTimeouts`
+func (g *Game) SetTimeouts(timeouts peer.Timeouts) {
+	g.timeouts = timeouts
+}
+
+// `SetLiarsTrail` makes the liars of the game observe the previous
+// true value whenever `SetTruth` changes it, the most believable lie
+// during a transition, instead of keeping their own lie
+func (g *Game) SetLiarsTrail(trail bool) {
+	g.trail = trail
+}
+
+// `ID` is the ID of the game
+func (g *Game) ID() string {
+	return g.id
+}
+
+// `Config` is the agents config of the game
+func (g *Game) Config() string {
+	return g.config
+}
+
+// `Values` describes the values of the game
+func (g *Game) Values() (reader.ValueSpec, error) {
+	config, err := reader.ReadGameConfig(g.config)
+	if err != nil {
+		return reader.DefaultValueSpec, err
+	}
+	return config.ValueSpec()
+}
+
+// `Agents` are the agents of the game
+func (g *Game) Agents() ([]reader.ParticipantSet, error) {
+	return reader.GetCurrentParticipants(g.config)
+}
+
+// `AddAgents` adds expert agents to the game. They take part in the
+// expert rounds played from now on.
+func (g *Game) AddAgents(params Params) error {
+	values, err := g.Values()
+	if err != nil {
+		return err
+	}
+	ports, err := params.validate(values)
+	if err != nil {
+		return err
+	}
+	err = params.addAgents(values, reader.RoleExpert, ports, g.config)
+	reader.CloseVaults()
+	if err != nil {
+		return fmt.Errorf("error in saving %s: %w", g.config, err)
+	}
+	return nil
+}
+
+// `addAgents` adds the agents of validated parameters to `config`
+func (p *Params) addAgents(values reader.ValueSpec, role string, ports reader.PortRange, config string) error {
+	if len(values.KEYS) > 0 {
+		return reader.AddKeyAgentsToConfig(p.AGENTS, p.KEYS, values.TYPE, p.RATIO, p.TRANSPORT, role, ports, config)
+	}
+	return reader.AddAgentsToConfig(p.AGENTS, p.VALUE, p.LIE, p.RATIO, p.TRANSPORT, role, ports, config)
+}
+
+// `Kill` removes agent `agent` from the network. A running agent
+// holds its vault and removes it itself.
+func (g *Game) Kill(agent string) error {
+	if len(reader.GetParticpantIP(g.config, agent)) == 0 {
+		return fmt.Errorf("%w %s in game %s", ErrNoAgent, agent, g.id)
+	}
+	// remove the value of the agent from its vault
+	// this makes the agent cast empty votes, which
+	// removes the respective peerID from the network
+	if client, err := peer.DialAgent(g.id, agent); err == nil {
+		defer client.Close()
+		return client.Kill()
+	}
+	defer reader.CloseVaults()
+	return peer.KillAgent(g.id, agent)
+}
+
+// `Results` is the result of the last round of the game
+func (g *Game) Results() (reader.GameResult, error) {
+	records, err := reader.ReadLedger(g.id)
+	if err != nil || len(records) == 0 {
+		return reader.GameResult{}, fmt.Errorf("%w in game %s", ErrNoRounds, g.id)
+	}
+	return reader.ResultOfRound(records[len(records)-1]), nil
+}
+
+// `Decided` is the result made of the values the first `numAgents`
+// agents of the game stand by, which expert agents update when they
+// decide. The network value is decided from them with the
+// aggregation of the game.
+func (g *Game) Decided(numAgents int) (reader.GameResult, error) {
+	agents, err := g.Agents()
+	if err != nil {
+		return reader.GameResult{}, err
+	}
+	if numAgents <= 0 || numAgents > len(agents) {
+		numAgents = len(agents)
+	}
+	spec, err := g.Values()
+	if err != nil {
+		return reader.GameResult{}, err
+	}
+
+	// go through the agent vaults to compute the truth value of network
+	// in expert mode, given a low liar-ratio, all the agents
+	// have decided on the truest value if `extend` is called earlier.
+	// In any other case `playexpert` may return a false value as well since numAgents
+	// may or may not be equal to total number of keys in the vault and truth value is decided
+	// by the aggregation of the game.
+	values := make([]string, numAgents)
+	votes := make([]reader.Value, numAgents)
+	for i := 0; i < numAgents; i++ {
+		values[i], _ = agentValue(g.id, agents[i].USER)
+		votes[i] = reader.Value(values[i])
+	}
+	result := reader.ResultOfValues(g.id, agents[:numAgents], values, spec, spec.Decide(votes))
+	reader.CloseVaults()
+	return result, nil
+}
+
+// `Stop` shuts down the running agents of the game and removes the
+// game with all of its artifacts but its ledger
+func (g *Game) Stop() error {
+	return Reset(g.config)
+}
+
+// `Reset` shuts down the running agents of the game played with
+// `config`, removes their storage and identities, and the config
+// itself. The ledger of the game is kept.
+func Reset(config string) error {
+	var shutdownErr error
+	if previous := reader.GetGameID(config); previous != "" {
+		// running agents release their vault before it is removed
+		if agents, err := reader.GetCurrentParticipants(config); err == nil {
+			shutdownErr = shutdownAgents(previous, agents)
+		}
+		reader.RemoveGameArtifacts(previous)
+		reader.UnregisterGame(previous)
+	}
+	if err := os.Remove(config); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return shutdownErr
+}
+
+// `shutdownAgents` shuts down the daemons of every agent of game
+// `game` and returns the first error
+func shutdownAgents(game string, agents []reader.ParticipantSet) error {
+	var first error
+	for _, agent := range agents {
+		if _, err := peer.ShutdownAgent(game, agent.USER); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// `Save` saves the game to the snapshot archive `file`, see
+// reader.SaveSnapshot. The vaults of running agents are read
+// through their daemons.
+func (g *Game) Save(file string) error {
+	err := reader.SaveSnapshot(g.config, file, func(agent string) (map[string][]byte, error) {
+		return agentPairs(g.id, agent)
+	})
+	reader.CloseVaults()
+	return err
+}
+
+// `Restore` restores the game of the snapshot archive `file` into
+// `config`, see reader.OpenSnapshot. Like `New`, it resets the game
+// `config` held before. The restored game is reset too if it is
+// still played meanwhile, so that no daemon holds a vault the
+// snapshot replaces.
+func Restore(file string, config string) (*Game, error) {
+	snapshot, err := reader.OpenSnapshot(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := Reset(config); err != nil {
+		return nil, err
+	}
+	if entry, ok := reader.FindGame(snapshot.MANIFEST.GAMEID); ok {
+		if err := Reset(entry.CONFIG); err != nil {
+			return nil, err
+		}
+	}
+	if err := snapshot.Restore(config); err != nil {
+		return nil, err
+	}
+	return Open(config)
+}
+
+// `agentPairs` returns the pairs in the vault of agent `user`,
+// asking its daemon if it has one and reading its vault otherwise
+func agentPairs(game string, user string) (map[string][]byte, error) {
+	if client, err := peer.DialAgent(game, user); err == nil {
+		defer client.Close()
+		return client.Vault()
+	}
+	db, err := reader.GetAgentVault(game, user)
+	if err != nil {
+		return nil, err
+	}
+	return db.Snapshot()
+}
+
+// `agentValue` returns the value agent `user` stands by, asking its
+// daemon if it has one and reading its vault otherwise
+func agentValue(game string, user string) (string, error) {
+	if client, err := peer.DialAgent(game, user); err == nil {
+		defer client.Close()
+		return client.Value()
+	}
+	return reader.GetAgentValue(game, user)
+}
@@ -0,0 +1,195 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"liarslie/peer"
+	"liarslie/reader"
+	"sync"
+	"time"
+)
+
+// `Play` plays a round with every agent of the game in mode `mode`
+// and records it in the ledger. If `ctx` is done before the agents
+// have decided, the round is abandoned and not recorded; a passed
+// deadline is reported as `peer.ErrTimeout`.
+//
+// In expert mode, running agents play in their own process and the
+// others are started for the round. The round is recorded even if
+// some agents fail to decide, the error tells why.
+func (g *Game) Play(ctx context.Context, mode string) (reader.GameResult, error) {
+	if ctx.Err() != nil {
+		return reader.GameResult{}, peer.ContextError(ctx)
+	}
+	agents, err := g.Agents()
+	if err != nil {
+		return reader.GameResult{}, err
+	}
+
+	started := time.Now()
+	var outcomes []peer.Outcome
+	switch mode {
+	case ModeStandard, "":
+		mode = ModeStandard
+		outcomes, err = g.playStandard(ctx, agents)
+	case ModeExpert:
+		outcomes, err = g.playExpert(ctx, agents)
+	default:
+		return reader.GameResult{}, fmt.Errorf("unknown mode %q", mode)
+	}
+	if outcomes == nil {
+		return reader.GameResult{}, err
+	}
+
+	record, recordErr := RecordRound(g.id, mode, started, outcomes)
+	if err == nil {
+		err = recordErr
+	}
+	return reader.ResultOfRound(*record), err
+}
+
+// `playStandard` plays a standard round over an in-process network
+func (g *Game) playStandard(ctx context.Context, agents []reader.ParticipantSet) ([]peer.Outcome, error) {
+	numAgents := len(agents)
+	network, err := peer.NewLocalNetwork(g.id, agents, reader.Seed())
+	if err != nil {
+		return nil, err
+	}
+	// running agents hold their vault, ask them for their value
+	for _, agent := range agents {
+		if client, err := peer.DialAgent(g.id, agent.USER); err == nil {
+			value, _ := client.Value()
+			client.Close()
+			network.SetValue(agent.USER, value)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numAgents)
+	outcomes := make([]peer.Outcome, numAgents)
+	// start standard mode network value computation;
+	// each goroutine only writes its own outcome
+	for i := 0; i < numAgents; i++ {
+		go func(i int) {
+			defer wg.Done()
+			outcomes[i] = peer.RunAsStandard(ctx, network, g.id, i, agents, numAgents)
+		}(i)
+	}
+	wg.Wait()
+	reader.CloseVaults()
+
+	if ctx.Err() != nil {
+		return nil, peer.ContextError(ctx)
+	}
+	return outcomes, nil
+}
+
+// `playExpert` plays an expert round over libp2p. Agents started
+// here are stopped once every agent is done. Agents that do not
+// decide in time fail the round, see `peer.Agent.Play`.
+func (g *Game) playExpert(ctx context.Context, agents []reader.ParticipantSet) ([]peer.Outcome, error) {
+	numAgents := len(agents)
+	outcomes := make([]peer.Outcome, numAgents)
+	errs := make([]error, numAgents)
+	started := make([]*peer.Agent, numAgents)
+
+	var wg sync.WaitGroup
+	wg.Add(numAgents)
+	for i := 0; i < numAgents; i++ {
+		go func(i int) {
+			defer wg.Done()
+			outcomes[i].USER = agents[i].USER
+			if client, err := peer.DialAgent(g.id, agents[i].USER); err == nil {
+				defer client.Close()
+				outcome, err := client.Play(ctx, numAgents, g.timeouts)
+				outcome.USER = agents[i].USER
+				outcomes[i], errs[i] = outcome, err
+				return
+			}
+
+			playStarted := time.Now()
+			agent, err := peer.StartAgent(ctx, g.id, i, agents)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", agents[i].USER, err)
+				return
+			}
+			started[i] = agent
+			outcomes[i], errs[i] = agent.Play(ctx, numAgents, g.timeouts)
+			outcomes[i].DURATION = time.Since(playStarted)
+		}(i)
+	}
+	wg.Wait()
+
+	// hosts take a while to close, close them side by side
+	var closing sync.WaitGroup
+	for _, agent := range started {
+		if agent != nil {
+			closing.Add(1)
+			go func(agent *peer.Agent) {
+				defer closing.Done()
+				agent.Stop()
+			}(agent)
+		}
+	}
+	closing.Wait()
+	reader.CloseVaults()
+
+	if ctx.Err() != nil {
+		return nil, peer.ContextError(ctx)
+	}
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if failed != nil {
+		// the first failure is wrapped, so that its type can be checked
+		return outcomes, fmt.Errorf("%d of %d agents did not decide, %w", len(failed), numAgents, failed[0])
+	}
+	return outcomes, nil
+}
+
+// `RecordRound` appends the outcome of a round of game `game`
+// to the ledger, together with the ground truth, and returns
+// the record. The network decided on the value its agents decided
+// on, aggregated like their votes.
+func RecordRound(game string, mode string, started time.Time, outcomes []peer.Outcome) (*reader.RoundRecord, error) {
+	truth, _ := reader.ReadGroundTruth(game)
+	liars := make(map[string]bool)
+	for _, liar := range truth.LIARS {
+		liars[liar] = true
+	}
+	values, err := reader.GetValueSpec(game)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &reader.RoundRecord{
+		GAME:     game,
+		MODE:     mode,
+		TRUTH:    truth.VALUE,
+		STARTED:  started,
+		DURATION: time.Since(started),
+		SEED:     reader.Seed(),
+		VALUES:   &values,
+	}
+	decisions := make([]reader.Value, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		decisions = append(decisions, reader.Value(outcome.DECIDED))
+		record.AGENTS = append(record.AGENTS, reader.AgentRecord{
+			USER:     outcome.USER,
+			LIAR:     liars[outcome.USER],
+			REPORTED: outcome.REPORTED,
+			RECEIVED: outcome.RECEIVED,
+			DECIDED:  outcome.DECIDED,
+			DURATION: outcome.DURATION,
+		})
+	}
+	record.DECIDED = values.Decide(decisions)
+
+	if err := reader.AppendRound(record); err != nil {
+		return record, fmt.Errorf("error in recording round: %w", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,255 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"liarslie/peer"
+	"liarslie/reader"
+	"strconv"
+	"strings"
+)
+
+// TruthSchedule decides the true value of round `round` of a run,
+// counted from 1, from the true value `truth` of the round before.
+// Schedules apply to games of a single int value.
+type TruthSchedule func(round int, truth int) int
+
+// `FixedTruth` keeps the true value of every round
+func FixedTruth(round int, truth int) int {
+	return truth
+}
+
+// `StepTruth` changes the true value by `delta` every `every` rounds
+func StepTruth(delta int, every int) TruthSchedule {
+	if every < 1 {
+		every = 1
+	}
+	return func(round int, truth int) int {
+		if round > 1 && (round-1)%every == 0 {
+			return truth + delta
+		}
+		return truth
+	}
+}
+
+// `RandomWalkTruth` moves the true value by up to `step` up or down
+// every round. The walk follows the seed of the process.
+func RandomWalkTruth(step int) TruthSchedule {
+	return func(round int, truth int) int {
+		if round == 1 || step < 1 {
+			return truth
+		}
+		return truth + reader.RandomIntn(2*step+1) - step
+	}
+}
+
+// `ListTruth` takes the true value of round i from `values[i-1]`.
+// Rounds past the end of the list keep the last value.
+func ListTruth(values []int) TruthSchedule {
+	return func(round int, truth int) int {
+		if len(values) == 0 {
+			return truth
+		}
+		if round > len(values) {
+			round = len(values)
+		}
+		return values[round-1]
+	}
+}
+
+// `ParseTruthSchedule` parses a schedule given on the command line:
+//
+//	step:DELTA[/EVERY]  changes the true value by DELTA every EVERY rounds (default 1)
+//	walk:STEP           moves the true value by up to STEP every round
+//	file:PATH           reads the true value of each round from PATH
+//
+// An empty schedule keeps the true value and is returned as nil.
+func ParseTruthSchedule(spec string) (TruthSchedule, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "step":
+		deltaArg, everyArg, hasEvery := strings.Cut(arg, "/")
+		delta, err := strconv.Atoi(deltaArg)
+		if err != nil {
+			return nil, fmt.Errorf("step schedule %q: bad delta: %w", spec, err)
+		}
+		every := 1
+		if hasEvery {
+			if every, err = strconv.Atoi(everyArg); err != nil || every < 1 {
+				return nil, fmt.Errorf("step schedule %q: every must be a number of rounds", spec)
+			}
+		}
+		return StepTruth(delta, every), nil
+	case "walk":
+		step, err := strconv.Atoi(arg)
+		if err != nil || step < 0 {
+			return nil, fmt.Errorf("walk schedule %q: step must be a positive number", spec)
+		}
+		return RandomWalkTruth(step), nil
+	case "file":
+		values, err := ReadTruthFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return ListTruth(values), nil
+	}
+	return nil, fmt.Errorf("unknown truth schedule %q, use step:DELTA[/EVERY], walk:STEP or file:PATH", spec)
+}
+
+// `ReadTruthFile` reads true values separated by commas, spaces or
+// newlines from `file`
+func ReadTruthFile(file string) ([]int, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no true values in %s", file)
+	}
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		if values[i], err = strconv.Atoi(field); err != nil {
+			return nil, fmt.Errorf("%s: true value %d: %w", file, i+1, err)
+		}
+	}
+	return values, nil
+}
+
+// `SetTruth` changes the true value of the game to `value`, parsed
+// as a value of the game, which for a game of keys holds the facts
+// of every key. Honest agents observe the new value. Liars keep the
+// lie they were given when they joined, unless `SetLiarsTrail` made
+// them trail the truth; a liar whose lie is the new value, or whose
+// lie was not recorded, observes the previous value instead. Every
+// agent drops the value it decided on and agrees anew in the next
+// round. Nothing changes if `value` is the current true value.
+func (g *Game) SetTruth(value reader.Value) error {
+	values, err := g.Values()
+	if err != nil {
+		return err
+	}
+	value, err = values.Canonical(string(value))
+	if err != nil {
+		return err
+	}
+	truth, err := reader.ReadGroundTruth(g.id)
+	if err != nil {
+		return err
+	}
+	if truth.VALUE == value {
+		return nil
+	}
+	agents, err := g.Agents()
+	if err != nil {
+		return err
+	}
+	liars := make(map[string]bool)
+	for _, liar := range truth.LIARS {
+		liars[liar] = true
+	}
+
+	defer reader.CloseVaults()
+	for _, agent := range agents {
+		observed := string(value)
+		if liars[agent.USER] {
+			observed = string(truth.VALUE)
+			if lie, ok := truth.LIES[agent.USER]; ok && !g.trail && lie != value {
+				observed = string(lie)
+			}
+		}
+		// running agents hold their vault, tell them instead
+		if client, err := peer.DialAgent(g.id, agent.USER); err == nil {
+			err = client.Observe(observed)
+			client.Close()
+		} else {
+			err = peer.ObserveValue(g.id, agent.USER, observed)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", agent.USER, err)
+		}
+	}
+	truth.VALUE = value
+	return reader.WriteGroundTruth(g.id, truth)
+}
+
+// Tracking is how closely the network followed the true value over
+// the rounds of a run
+type Tracking struct {
+	ROUNDS []reader.GameResult
+	// CORRECT is the number of rounds the network decided the truth in
+	CORRECT int
+	// ACCURACY is the mean share of honest agents deciding the truth
+	ACCURACY float64
+	// CHANGES is the number of rounds the true value changed in, and
+	// TRACKED the number of them the network decided the new truth in
+	CHANGES int
+	TRACKED int
+}
+
+// `PlayRounds` plays `rounds` rounds in mode `mode`, changing the
+// true value before each round as `schedule` decides, or keeping it
+// if `schedule` is nil. A round whose agents fail to decide does not
+// end the run; its error is returned once every round is played. If
+// `ctx` is done the run ends with the rounds played so far.
+func (g *Game) PlayRounds(ctx context.Context, mode string, rounds int, schedule TruthSchedule) (Tracking, error) {
+	var tracking Tracking
+	if rounds < 1 {
+		return tracking, fmt.Errorf("the number of rounds must be at least 1")
+	}
+	truth, err := reader.ReadGroundTruth(g.id)
+	if err != nil {
+		return tracking, err
+	}
+	values, err := g.Values()
+	if err != nil {
+		return tracking, err
+	}
+	current, err := strconv.Atoi(string(truth.VALUE))
+	if schedule != nil && (err != nil || values.TYPE != reader.TypeInt || len(values.KEYS) > 0) {
+		return tracking, fmt.Errorf("the truth of game %s can only change on a schedule in games of a single int value", g.id)
+	}
+
+	var failed error
+	for round := 1; round <= rounds; round++ {
+		changed := false
+		if schedule != nil {
+			next := schedule(round, current)
+			if next < 0 {
+				next = 0
+			}
+			if err := g.SetTruth(reader.IntValue(next)); err != nil {
+				return tracking, fmt.Errorf("round %d: %w", round, err)
+			}
+			changed = next != current
+			current = next
+		}
+
+		result, err := g.Play(ctx, mode)
+		if result.GAME == "" {
+			return tracking, fmt.Errorf("round %d: %w", round, err)
+		}
+		if err != nil && failed == nil {
+			failed = fmt.Errorf("round %d: %w", round, err)
+		}
+		tracking.ROUNDS = append(tracking.ROUNDS, result)
+		tracking.ACCURACY += result.ACCURACY
+		if result.CORRECT {
+			tracking.CORRECT++
+		}
+		if changed {
+			tracking.CHANGES++
+			if result.CORRECT {
+				tracking.TRACKED++
+			}
+		}
+	}
+	tracking.ACCURACY /= float64(len(tracking.ROUNDS))
+	return tracking, failed
+}
@@ -0,0 +1,203 @@
+package game
+
+import (
+	"context"
+	"io/ioutil"
+	"liarslie/reader"
+	"os"
+	"testing"
+)
+
+// `inTempDir` runs the rest of the test in a fresh working directory,
+// where games keep their config, vaults and ledger
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// `newTestGame` starts a game of `agents` standard agents, `ratio`
+// of them liars observing `lie`, about the true value `value`
+func newTestGame(t *testing.T, value string, lie string, agents int, ratio float64) *Game {
+	t.Helper()
+	inTempDir(t)
+	t.Cleanup(reader.CloseVaults)
+	g, err := New(Options{
+		Params: Params{VALUE: reader.Value(value), LIE: reader.Value(lie), MAXVALUE: 10, AGENTS: agents, RATIO: ratio},
+		SEED:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestStepTruth(t *testing.T) {
+	for _, test := range []struct {
+		delta, every int
+		want         []int
+	}{
+		{2, 1, []int{5, 7, 9, 11, 13}},
+		{1, 2, []int{5, 5, 6, 6, 7}},
+		{-3, 3, []int{5, 5, 5, 2, 2}},
+		// a bad interval changes the truth every round
+		{1, 0, []int{5, 6, 7, 8, 9}},
+	} {
+		schedule, truth := StepTruth(test.delta, test.every), 5
+		for round, want := range test.want {
+			if truth = schedule(round+1, truth); truth != want {
+				t.Errorf("step %d/%d: round %d has truth %d, want %d", test.delta, test.every, round+1, truth, want)
+			}
+		}
+	}
+}
+
+func TestListTruth(t *testing.T) {
+	schedule := ListTruth([]int{3, 8, 4})
+	for round, want := range []int{3, 8, 4, 4, 4} {
+		if got := schedule(round+1, 0); got != want {
+			t.Errorf("round %d has truth %d, want %d", round+1, got, want)
+		}
+	}
+	if got := ListTruth(nil)(2, 7); got != 7 {
+		t.Errorf("an empty list changed the truth to %d", got)
+	}
+}
+
+func TestParseTruthSchedule(t *testing.T) {
+	inTempDir(t)
+	if err := ioutil.WriteFile("truth.txt", []byte("4, 6\n9"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		spec string
+		want []int
+	}{
+		{"step:2", []int{5, 7, 9}},
+		{"step:-1/2", []int{5, 5, 4}},
+		{"walk:0", []int{5, 5, 5}},
+		{"file:truth.txt", []int{4, 6, 9}},
+	} {
+		schedule, err := ParseTruthSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		truth := 5
+		for round, want := range test.want {
+			if truth = schedule(round+1, truth); truth != want {
+				t.Errorf("%s: round %d has truth %d, want %d", test.spec, round+1, truth, want)
+			}
+		}
+	}
+
+	if schedule, err := ParseTruthSchedule(""); schedule != nil || err != nil {
+		t.Errorf("an empty schedule parsed to %v, %v", schedule, err)
+	}
+	for _, spec := range []string{"step", "step:x", "step:1/0", "step:1/x", "walk:-1", "walk:x", "file:missing.txt", "jump:3"} {
+		if _, err := ParseTruthSchedule(spec); err == nil {
+			t.Errorf("%s parsed", spec)
+		}
+	}
+}
+
+func TestPlayRoundsTracksTheTruth(t *testing.T) {
+	g := newTestGame(t, "5", "", 5, 0)
+
+	// the truth changes before rounds 3 and 5
+	tracking, err := g.PlayRounds(context.Background(), ModeStandard, 5, StepTruth(2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracking.ROUNDS) != 5 || tracking.CORRECT != 5 || tracking.CHANGES != 2 || tracking.TRACKED != 2 {
+		t.Errorf("tracked %d rounds, %d correct, %d of %d changes, want 5, 5, 2 of 2",
+			len(tracking.ROUNDS), tracking.CORRECT, tracking.TRACKED, tracking.CHANGES)
+	}
+	if tracking.ACCURACY != 1 {
+		t.Errorf("accuracy is %v, want 1", tracking.ACCURACY)
+	}
+	for i, want := range []reader.Value{"5", "5", "7", "7", "9"} {
+		if round := tracking.ROUNDS[i]; round.TRUTH != want || round.DECIDED != want {
+			t.Errorf("round %d decided %s with truth %s, want %s", i+1, round.DECIDED, round.TRUTH, want)
+		}
+	}
+}
+
+func TestPlayRoundsCountsMissedChanges(t *testing.T) {
+	// 3 of 5 agents lie, so the network decides the lie every round
+	g := newTestGame(t, "5", "9", 5, 0.6)
+
+	tracking, err := g.PlayRounds(context.Background(), ModeStandard, 3, ListTruth([]int{5, 6, 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.CORRECT != 0 || tracking.CHANGES != 1 || tracking.TRACKED != 0 {
+		t.Errorf("%d correct, %d of %d changes tracked, want 0, 0 of 1",
+			tracking.CORRECT, tracking.TRACKED, tracking.CHANGES)
+	}
+}
+
+func TestSetTruthKeepsLies(t *testing.T) {
+	g := newTestGame(t, "5", "9", 5, 0.4)
+	truth, err := reader.ReadGroundTruth(g.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(truth.LIARS) != 2 {
+		t.Fatalf("the game has %d liars, want 2", len(truth.LIARS))
+	}
+	observed := func() map[string]string {
+		t.Helper()
+		values := make(map[string]string)
+		agents, err := g.Agents()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, agent := range agents {
+			if values[agent.USER], err = reader.GetAgentValue(g.ID(), agent.USER); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return values
+	}
+	check := func(honest, liar string) {
+		t.Helper()
+		liars := make(map[string]bool)
+		for _, name := range truth.LIARS {
+			liars[name] = true
+		}
+		for agent, value := range observed() {
+			want := honest
+			if liars[agent] {
+				want = liar
+			}
+			if value != want {
+				t.Errorf("%s observes %s, want %s", agent, value, want)
+			}
+		}
+	}
+
+	for _, step := range []struct {
+		truth, liar string
+		trail       bool
+	}{
+		{"6", "9", false},
+		{"7", "9", false},
+		// a lie that became the truth gives way to the previous truth
+		{"9", "7", false},
+		{"4", "9", false},
+		{"3", "4", true},
+	} {
+		g.SetLiarsTrail(step.trail)
+		if err := g.SetTruth(reader.Value(step.truth)); err != nil {
+			t.Fatal(err)
+		}
+		check(step.truth, step.liar)
+	}
+}
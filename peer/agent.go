@@ -0,0 +1,270 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"liarslie/reader"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// Progress receives the progress messages of the agents run by this
+// process. Commands writing a structured result to stdout point it
+// elsewhere.
+var Progress io.Writer = os.Stdout
+
+// Agent is an expert agent that stays on the network between
+// rounds. It keeps its host, its subscription to the game topic
+// and the scores of its peers for as long as it runs, and keeps
+// publishing the value it currently stands by. `StartAgent` starts
+// it and `Stop` releases everything it holds.
+type Agent struct {
+	game   string
+	user   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	h      host.Host
+	dht    *dht.IpfsDHT
+	ps     *pubsub.PubSub
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+	book   *scoreBook
+	// messenger answers and sends direct messages over AgentProtocol
+	messenger *Messenger
+	// values describes the values the agent decides on
+	values reader.ValueSpec
+	// goroutines counts the discovery and publish goroutines
+	goroutines sync.WaitGroup
+	stop       sync.Once
+	// discovered is closed when the search for peers ends, with
+	// discoveryErr set if it failed
+	discovered   chan struct{}
+	discoveryErr error
+	// round serializes the rounds played by the agent
+	round sync.Mutex
+}
+
+// `StartAgent` starts the host of agent `i` of game `game` on the
+// address recorded in the agents config and joins the game topic.
+// The agent leaves the network when `ctx` is done or it is stopped;
+// only `Stop` releases its host and vault.
+func StartAgent(ctx context.Context, game string, i int, agents []reader.ParticipantSet) (*Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, ContextError(ctx)
+	}
+	values, err := reader.GetValueSpec(game)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	a := &Agent{game: game, user: agents[i].USER, ctx: ctx, cancel: cancel, values: values, discovered: make(chan struct{})}
+	topicName := topicName(game)
+	// load the identity generated for this agent at `start`/`extend`
+	priv, err := reader.LoadIdentity(reader.GameKeystoreDir(game), agents[i].USER)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// create a new libp2p Host that listens on the allocated address
+	// and can dial every transport used in the fleet
+	a.h, err = libp2p.New(
+		libp2p.Identity(priv),
+		libp2p.ListenAddrStrings(agents[i].IP),
+		transportOptions(agents),
+	)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// register the direct agent protocol so that peers
+	// can address this agent point-to-point
+	a.messenger = NewMessenger(a.h, agentHandler(game, agents[i].USER))
+
+	a.dht, err = dht.New(ctx, a.h)
+	if err != nil {
+		a.Stop()
+		return nil, err
+	}
+	// discover peers in a separate thread
+	a.goroutines.Add(1)
+	go func() {
+		defer a.goroutines.Done()
+		a.discoveryErr = discoverPeers(ctx, a.h, a.dht, game, agents)
+		close(a.discovered)
+	}()
+
+	// start gossipsub with peer scoring so that peers contradicting
+	// the decided value are graylisted; the agent remembers the
+	// peers that contradicted it in earlier rounds
+	vault, err := reader.GetAgentVault(game, a.user)
+	if err != nil {
+		a.Stop()
+		return nil, err
+	}
+	if a.book, err = newScoreBook(a.h.ID().Pretty(), vault); err != nil {
+		a.Stop()
+		return nil, err
+	}
+	a.ps, err = pubsub.NewGossipSub(ctx, a.h, scoreOptions(topicName, a.book)...)
+	if err != nil {
+		a.Stop()
+		return nil, err
+	}
+	for _, p := range a.book.blacklisted() {
+		a.ps.BlacklistPeer(p)
+	}
+
+	// join the topic
+	a.topic, err = a.ps.Join(topicName)
+	if err != nil {
+		a.Stop()
+		return nil, err
+	}
+
+	// agents only ever share their own value; a killed agent
+	// has no value and publishes an empty vote
+	a.goroutines.Add(1)
+	go func() {
+		defer a.goroutines.Done()
+		publishTopic(ctx, a.topic, game, a.user, a.Value)
+	}()
+
+	a.sub, err = a.topic.Subscribe()
+	if err != nil {
+		a.Stop()
+		return nil, err
+	}
+	return a, nil
+}
+
+// `PeerID` is the peer ID of the host of the agent
+func (a *Agent) PeerID() string {
+	return a.h.ID().Pretty()
+}
+
+// `Value` is the value the agent currently stands by
+func (a *Agent) Value() string {
+	value, _ := reader.GetAgentValue(a.game, a.user)
+	return value
+}
+
+// `Play` takes part in a round with `numAgents` agents and returns
+// once the agent has heard from all of them. The phases of the round
+// are bounded by `timeouts`: it fails with ErrNoPeers if no peer is
+// found in time, with ErrQuorumNotReached if not every peer votes in
+// time and with ErrTimeout if the deadline of `ctx` passes first.
+func (a *Agent) Play(ctx context.Context, numAgents int, timeouts Timeouts) (Outcome, error) {
+	a.round.Lock()
+	defer a.round.Unlock()
+	started := time.Now()
+	outcome := Outcome{USER: a.user, REPORTED: a.Value()}
+	defer func() {
+		outcome.DURATION = time.Since(started)
+	}()
+
+	// the round ends when the caller gives up or the agent is stopped
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-a.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if numAgents > 1 {
+		if err := a.waitForPeers(ctx, timeouts.DISCOVERY); err != nil {
+			return outcome, fmt.Errorf("%s: %w", a.user, a.interrupted(ctx, err))
+		}
+	}
+
+	roundCtx, cancelRound := withTimeout(ctx, timeouts.ROUND)
+	defer cancelRound()
+	var votes int
+	var err error
+	outcome.DECIDED, outcome.RECEIVED, votes, err = computeNetworkValueExpert(a.h, roundCtx, a.ps, a.sub, a.messenger, a.book, a.values, a.game, a.user, numAgents)
+	if err == nil && roundCtx.Err() != nil {
+		err = fmt.Errorf("%w: heard from %d of %d peers in %s", ErrQuorumNotReached, votes, numAgents-1, timeouts.ROUND)
+	}
+	if err != nil {
+		return outcome, fmt.Errorf("%s: %w", a.user, a.interrupted(ctx, err))
+	}
+	return outcome, nil
+}
+
+// `waitForPeers` waits until the agent shares the game topic with
+// a peer, for at most `timeout`
+func (a *Agent) waitForPeers(ctx context.Context, timeout time.Duration) error {
+	discoveryCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	discovered := a.discovered
+	for len(a.topic.ListPeers()) == 0 {
+		select {
+		case <-discovered:
+			// the search failed, or succeeded and the peer is
+			// about to join the topic
+			if a.discoveryErr != nil {
+				return fmt.Errorf("%w: %v", ErrNoPeers, a.discoveryErr)
+			}
+			discovered = nil
+		case <-ticker.C:
+		case <-discoveryCtx.Done():
+			return fmt.Errorf("%w for game %s within %s", ErrNoPeers, a.game, timeout)
+		}
+	}
+	return nil
+}
+
+// `interrupted` explains why a round ended early: the agent was
+// stopped or `ctx` is done. Otherwise it returns `err`.
+func (a *Agent) interrupted(ctx context.Context, err error) error {
+	if a.ctx.Err() != nil {
+		return ErrAgentStopped
+	}
+	if ctx.Err() != nil {
+		return ContextError(ctx)
+	}
+	return err
+}
+
+// `Stop` takes the agent off the network. A round in progress ends
+// without a decision. Once its goroutines have returned, the agent
+// leaves the game topic, closes its DHT and host, which frees its
+// port, and flushes and closes its vault. Stopping an agent again
+// does nothing.
+func (a *Agent) Stop() error {
+	var err error
+	a.stop.Do(func() {
+		a.cancel()
+		a.goroutines.Wait()
+		// wait for a round in progress to give up
+		a.round.Lock()
+		defer a.round.Unlock()
+
+		if a.sub != nil {
+			a.sub.Cancel()
+		}
+		if a.topic != nil {
+			a.topic.Close()
+		}
+		if a.dht != nil {
+			a.dht.Close()
+		}
+		a.messenger.Close()
+		err = a.h.Close()
+		if vaultErr := reader.CloseAgentVault(a.game, a.user); err == nil {
+			err = vaultErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,510 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"liarslie/reader"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrAgentNotRunning is returned when no daemon serves an agent
+var ErrAgentNotRunning = errors.New("agent is not running")
+
+// AgentStatus is what an agent daemon reports about itself
+type AgentStatus struct {
+	GAME    string
+	USER    string
+	ROLE    string
+	IP      string
+	PEERID  string
+	PID     int
+	STARTED time.Time
+	VALUE   string
+	ROUNDS  int
+	LAST    *Outcome `json:",omitempty"`
+}
+
+// playRequest triggers a round with AGENTS agents, bounded by
+// TIMEOUTS. Zero AGENTS plays with every agent in the agents config.
+type playRequest struct {
+	AGENTS   int
+	TIMEOUTS Timeouts
+}
+
+// valueResponse carries the value an agent stands by
+type valueResponse struct {
+	VALUE string
+}
+
+// errorResponse carries the error of a failed request. KIND names
+// the typed error it wraps, so that clients can check for it.
+type errorResponse struct {
+	ERROR string
+	KIND  string `json:",omitempty"`
+}
+
+// `ControlSocket` is the Unix socket agent `agent` of game `game`
+// serves its control API on
+func ControlSocket(game string, agent string) string {
+	return filepath.Join(reader.RunDir(game), agent+".sock")
+}
+
+// Daemon runs a single agent as a long-lived process. It holds the
+// vault of the agent and, for expert agents, keeps its host on the
+// network. Other processes reach the agent through its control API,
+// JSON over HTTP on a Unix socket:
+//
+//	GET  /status    status of the agent
+//	GET  /value     value the agent stands by
+//	GET  /vault     pairs in the vault of the agent
+//	POST /kill      removes the value of the agent
+//	POST /observe   makes the agent observe a new value
+//	POST /play      plays a round (expert agents only)
+//	POST /shutdown  stops the daemon
+//	GET  /events    events of the agent, as server-sent events
+type Daemon struct {
+	config   string
+	game     string
+	agent    reader.ParticipantSet
+	expert   *Agent
+	socket   string
+	listener net.Listener
+	server   *http.Server
+	started  time.Time
+	// closing is closed when the daemon starts shutting down,
+	// stopped once it has released the agent
+	closing chan struct{}
+	stopped chan struct{}
+	stop    sync.Once
+
+	mu     sync.Mutex
+	rounds int
+	last   *Outcome
+}
+
+// `NewDaemon` prepares agent `name` of the game in `config` to run
+// as a daemon: it takes hold of the vault of the agent, starts its
+// host if it is an expert and listens on its control socket
+func NewDaemon(config string, name string) (*Daemon, error) {
+	game := reader.GetGameID(config)
+	agents, err := reader.GetCurrentParticipants(config)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, agent := range agents {
+		if agent.USER == name {
+			index = i
+		}
+	}
+	if game == "" || index < 0 {
+		return nil, fmt.Errorf("no agent named %s in %s", name, config)
+	}
+
+	d := &Daemon{
+		config:  config,
+		game:    game,
+		agent:   agents[index],
+		socket:  ControlSocket(game, name),
+		started: time.Now(),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if client, err := DialAgent(game, name); err == nil {
+		client.Close()
+		return nil, fmt.Errorf("%s is already running", name)
+	}
+	// a socket left behind by a daemon that did not shut down cleanly
+	os.Remove(d.socket)
+	if err := os.MkdirAll(filepath.Dir(d.socket), 0755); err != nil {
+		return nil, err
+	}
+
+	if _, err := reader.GetAgentVault(game, name); err != nil {
+		return nil, err
+	}
+	if d.agent.ROLE == reader.RoleExpert {
+		if d.expert, err = StartAgent(context.Background(), game, index, agents); err != nil {
+			reader.CloseVaults()
+			return nil, err
+		}
+	}
+	if d.listener, err = net.Listen("unix", d.socket); err != nil {
+		d.release()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", d.handleStatus)
+	mux.HandleFunc("/value", d.handleValue)
+	mux.HandleFunc("/vault", d.handleVault)
+	mux.HandleFunc("/kill", d.handleKill)
+	mux.HandleFunc("/observe", d.handleObserve)
+	mux.HandleFunc("/play", d.handlePlay)
+	mux.HandleFunc("/shutdown", d.handleShutdown)
+	mux.HandleFunc("/events", d.handleEvents)
+	d.server = &http.Server{Handler: mux}
+	return d, nil
+}
+
+// `Socket` is the control socket of the daemon
+func (d *Daemon) Socket() string {
+	return d.socket
+}
+
+// `Serve` answers control requests until the daemon is shut down
+func (d *Daemon) Serve() error {
+	err := d.server.Serve(d.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-d.stopped
+		return nil
+	}
+	return err
+}
+
+// `Shutdown` stops answering control requests, takes the agent off
+// the network and releases its vault and socket
+func (d *Daemon) Shutdown() {
+	d.stop.Do(func() {
+		// end the event streams, which would hold up the shutdown
+		close(d.closing)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d.server.Shutdown(ctx)
+		d.release()
+		close(d.stopped)
+	})
+}
+
+// `release` closes the host and the vault of the agent and removes
+// the control socket
+func (d *Daemon) release() {
+	if d.expert != nil {
+		d.expert.Stop()
+	}
+	reader.CloseVaults()
+	os.Remove(d.socket)
+}
+
+// `value` is the value the agent currently stands by
+func (d *Daemon) value() string {
+	value, _ := reader.GetAgentValue(d.game, d.agent.USER)
+	return value
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	d.mu.Lock()
+	status := AgentStatus{
+		GAME:    d.game,
+		USER:    d.agent.USER,
+		ROLE:    d.agent.ROLE,
+		IP:      d.agent.IP,
+		PEERID:  d.agent.PEERID,
+		PID:     os.Getpid(),
+		STARTED: d.started,
+		VALUE:   d.value(),
+		ROUNDS:  d.rounds,
+		LAST:    d.last,
+	}
+	d.mu.Unlock()
+	if d.expert != nil {
+		status.PEERID = d.expert.PeerID()
+	}
+	writeControlResponse(w, http.StatusOK, status)
+}
+
+func (d *Daemon) handleValue(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeControlResponse(w, http.StatusOK, valueResponse{VALUE: d.value()})
+}
+
+func (d *Daemon) handleVault(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	db, err := reader.GetAgentVault(d.game, d.agent.USER)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	pairs, err := db.Snapshot()
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeControlResponse(w, http.StatusOK, pairs)
+}
+
+func (d *Daemon) handleKill(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := KillAgent(d.game, d.agent.USER); err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fmt.Fprintln(Progress, d.agent.USER, "is removed from the network")
+	writeControlResponse(w, http.StatusOK, valueResponse{VALUE: d.value()})
+}
+
+func (d *Daemon) handleObserve(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req valueResponse
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := ObserveValue(d.game, d.agent.USER, req.VALUE); err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fmt.Fprintln(Progress, d.agent.USER, "observes", req.VALUE)
+	writeControlResponse(w, http.StatusOK, valueResponse{VALUE: d.value()})
+}
+
+func (d *Daemon) handlePlay(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if d.expert == nil {
+		writeControlError(w, http.StatusConflict, fmt.Errorf("%s is a %s agent, its rounds are played by `standard play`", d.agent.USER, d.agent.ROLE))
+		return
+	}
+	var req playRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.AGENTS <= 0 {
+		agents, err := reader.GetCurrentParticipants(d.config)
+		if err != nil {
+			writeControlError(w, http.StatusInternalServerError, err)
+			return
+		}
+		req.AGENTS = len(agents)
+	}
+
+	fmt.Fprintln(Progress, d.agent.USER, "is playing a round with", req.AGENTS, "agents")
+	// the round is abandoned if the client goes away
+	outcome, err := d.expert.Play(r.Context(), req.AGENTS, req.TIMEOUTS)
+	d.mu.Lock()
+	d.rounds++
+	d.last = &outcome
+	d.mu.Unlock()
+	if err != nil {
+		fmt.Fprintln(Progress, err)
+		writeControlError(w, playStatus(err), err)
+		return
+	}
+	fmt.Fprintln(Progress, d.agent.USER, "decided on", outcome.DECIDED)
+	writeControlResponse(w, http.StatusOK, outcome)
+}
+
+// `playStatus` is the status of a round that failed with `err`.
+// Rounds short of time or peers time out like with `serve`, rounds
+// of a stopping agent are unavailable.
+func playStatus(err error) int {
+	switch kindOf(err) {
+	case "no-peers", "quorum", "timeout":
+		return http.StatusGatewayTimeout
+	case "stopped":
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (d *Daemon) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	writeControlResponse(w, http.StatusOK, struct{}{})
+	// shut down once the response has been sent
+	go d.Shutdown()
+}
+
+func (d *Daemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	ServeEvents(w, r, d.game, d.closing)
+}
+
+// `allowMethod` rejects requests that do not use `method`
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeControlError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s %s is not supported", r.Method, r.URL.Path))
+		return false
+	}
+	return true
+}
+
+// `writeControlResponse` writes `v` as the JSON response of a request
+func writeControlResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// `writeControlError` writes `err` as the response of a failed request
+func writeControlError(w http.ResponseWriter, code int, err error) {
+	writeControlResponse(w, code, errorResponse{ERROR: err.Error(), KIND: kindOf(err)})
+}
+
+// ControlClient talks to the control API of an agent daemon
+type ControlClient struct {
+	agent     string
+	client    *http.Client
+	transport *http.Transport
+}
+
+// `DialAgent` connects to the daemon of agent `agent` of game `game`.
+// It returns `ErrAgentNotRunning` if no daemon answers. The client
+// keeps a connection to the socket of the daemon until it is closed.
+func DialAgent(game string, agent string) (*ControlClient, error) {
+	socket := ControlSocket(game, agent)
+	if _, err := os.Stat(socket); err != nil {
+		return nil, ErrAgentNotRunning
+	}
+	dialer := net.Dialer{Timeout: time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	c := &ControlClient{
+		agent:     agent,
+		client:    &http.Client{Transport: transport},
+		transport: transport,
+	}
+	if _, err := c.Status(); err != nil {
+		c.Close()
+		return nil, ErrAgentNotRunning
+	}
+	return c, nil
+}
+
+// `Close` closes the connections of the client to the daemon
+func (c *ControlClient) Close() {
+	c.transport.CloseIdleConnections()
+}
+
+// `ShutdownAgent` shuts down the daemon of agent `agent` of game
+// `game`, if it has one, and waits until it has released the agent
+func ShutdownAgent(game string, agent string) (bool, error) {
+	client, err := DialAgent(game, agent)
+	if err != nil {
+		return false, nil
+	}
+	defer client.Close()
+	if err := client.Shutdown(); err != nil {
+		return true, err
+	}
+	socket := ControlSocket(game, agent)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if _, err := os.Stat(socket); os.IsNotExist(err) {
+			return true, nil
+		}
+	}
+	return true, fmt.Errorf("%s did not shut down in time", agent)
+}
+
+// `Status` returns the status of the agent
+func (c *ControlClient) Status() (AgentStatus, error) {
+	var status AgentStatus
+	err := c.call(context.Background(), http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+// `Value` returns the value the agent stands by
+func (c *ControlClient) Value() (string, error) {
+	var resp valueResponse
+	err := c.call(context.Background(), http.MethodGet, "/value", nil, &resp)
+	return resp.VALUE, err
+}
+
+// `Vault` returns the pairs in the vault of the agent, which the
+// daemon holds
+func (c *ControlClient) Vault() (map[string][]byte, error) {
+	var pairs map[string][]byte
+	err := c.call(context.Background(), http.MethodGet, "/vault", nil, &pairs)
+	return pairs, err
+}
+
+// `Kill` removes the value of the agent
+func (c *ControlClient) Kill() error {
+	return c.call(context.Background(), http.MethodPost, "/kill", nil, nil)
+}
+
+// `Observe` makes the agent observe `value`, see `ObserveValue`
+func (c *ControlClient) Observe(value string) error {
+	return c.call(context.Background(), http.MethodPost, "/observe", valueResponse{VALUE: value}, nil)
+}
+
+// `Play` has the agent play a round with `numAgents` agents, bounded
+// by `timeouts`, and returns once it has decided or `ctx` is done
+func (c *ControlClient) Play(ctx context.Context, numAgents int, timeouts Timeouts) (Outcome, error) {
+	var outcome Outcome
+	err := c.call(ctx, http.MethodPost, "/play", playRequest{AGENTS: numAgents, TIMEOUTS: timeouts}, &outcome)
+	return outcome, err
+}
+
+// `Shutdown` stops the daemon
+func (c *ControlClient) Shutdown() error {
+	return c.call(context.Background(), http.MethodPost, "/shutdown", nil, nil)
+}
+
+// `Events` calls `fn` for every event of the agent until the daemon
+// shuts down or `ctx` is done
+func (c *ControlClient) Events(ctx context.Context, fn func(Event)) error {
+	return WatchEvents(ctx, c.client, "http://"+c.agent+"/events", fn)
+}
+
+// `call` sends a request to the daemon and decodes its response
+// into `out`
+func (c *ControlClient) call(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+c.agent+path, &body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.ERROR == "" {
+			return fmt.Errorf("%s: %s", c.agent, resp.Status)
+		}
+		if typed, ok := errorKinds[failure.KIND]; ok {
+			return remoteError{message: failure.ERROR, typed: typed}
+		}
+		return fmt.Errorf("%s: %s", c.agent, failure.ERROR)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
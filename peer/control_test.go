@@ -0,0 +1,52 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayErrorsKeepTheirKind(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-expired.Done()
+	for _, test := range []struct {
+		err    error
+		status int
+		typed  error
+	}{
+		{fmt.Errorf("a: %w", ErrNoPeers), http.StatusGatewayTimeout, ErrNoPeers},
+		{fmt.Errorf("a: %w: heard from 1 of 3 peers", ErrQuorumNotReached), http.StatusGatewayTimeout, ErrQuorumNotReached},
+		{ContextError(expired), http.StatusGatewayTimeout, ErrTimeout},
+		{ErrAgentStopped, http.StatusServiceUnavailable, ErrAgentStopped},
+		{errors.New("vault is closed"), http.StatusInternalServerError, nil},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeControlError(w, playStatus(test.err), test.err)
+		}))
+		transport := server.Client().Transport.(*http.Transport)
+		client := &ControlClient{
+			agent:     strings.TrimPrefix(server.URL, "http://"),
+			client:    &http.Client{Transport: transport, Timeout: 5 * time.Second},
+			transport: transport,
+		}
+
+		if status := playStatus(test.err); status != test.status {
+			t.Errorf("%v: status %d, want %d", test.err, status, test.status)
+		}
+		_, err := client.Play(context.Background(), 3, DefaultTimeouts)
+		if err == nil || !strings.Contains(err.Error(), test.err.Error()) {
+			t.Errorf("%v: the client got %v", test.err, err)
+		}
+		if test.typed != nil && !errors.Is(err, test.typed) {
+			t.Errorf("%v: the client got %v, not a %v", test.err, err, test.typed)
+		}
+		client.Close()
+		server.Close()
+	}
+}
@@ -5,11 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"liarslie/reader"
-	"sort"
 	"sync"
 	"time"
 
-	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/host"
@@ -22,56 +20,71 @@ var (
 	topicNameFlag = flag.String("topicName", "liarslie", "name of topic to join")
 )
 
-// `RunAsExpert` runs the discovery process and updates network value for a host
-func RunAsExpert(i int, agents []reader.ParticipantSet, numAgents int, computeValue bool) {
-	ctx := context.Background()
-	// create a new libp2p Host that listens on the allocated TCP port
-	h, err := libp2p.New(libp2p.ListenAddrStrings(agents[i].IP))
-	if err != nil {
-		panic(err)
-	}
-	// discover peers in a separate thread
-	go discoverPeers(ctx, h)
-
-	// start gossipsub
-	ps, err := pubsub.NewGossipSub(ctx, h)
-	if err != nil {
-		panic(err)
-	}
+const (
+	// pullAfter is how long an expert agent waits for gossip before
+	// it asks the peers that have not voted directly
+	pullAfter = 3 * time.Second
+	// publishInterval is how often an expert agent publishes its
+	// value to the game topic
+	publishInterval = 500 * time.Millisecond
+	// maxPublishBackoff bounds the wait after failed publishes,
+	// which doubles from publishInterval with every failure
+	maxPublishBackoff = 10 * time.Second
+)
 
-	// join the topic
-	topic, err := ps.Join(*topicNameFlag)
-	if err != nil {
-		panic(err)
+// `topicName` scopes the topic and rendezvous string to game `game`,
+// so that concurrent games on the same network do not cross-talk
+func topicName(game string) string {
+	if game == "" {
+		return *topicNameFlag
 	}
+	return *topicNameFlag + "/" + game
+}
 
-	go publishTopic(ctx, topic, agents[i].IP)
-
-	sub, err := topic.Subscribe()
-	if err != nil {
-		panic(err)
-	}
+// Outcome summarises what an agent did during a round
+type Outcome struct {
+	USER     string
+	REPORTED string
+	RECEIVED int
+	DECIDED  string
+	DURATION time.Duration
+}
 
-	if computeValue {
-		computeNetworkValueExpert(h, ctx, sub, agents[i].IP, numAgents)
+// `RunAsStandard` runs updates network value for a host of game `game` in Standard Mode.
+// Agents learn each other's values through the in-process network `network`. If `ctx`
+// is done before all messages arrived, the agent decides on the messages it has.
+func RunAsStandard(ctx context.Context, network *LocalNetwork, game string, i int, agents []reader.ParticipantSet, numAgents int) Outcome {
+	started := time.Now()
+	outcome := Outcome{USER: agents[i].USER}
+	outcome.REPORTED, outcome.DECIDED, outcome.RECEIVED = computeNetworkValueStandard(ctx, network, game, i, agents, numAgents)
+	outcome.DURATION = time.Since(started)
+	if outcome.DECIDED != "" {
+		emit(Event{TYPE: EventValueDecided, GAME: game, AGENT: outcome.USER, VALUE: outcome.DECIDED})
 	}
+	return outcome
 }
 
-// `RunAsStandard` runs updates network value for a host in Standard Mode
-func RunAsStandard(i int, agents []reader.ParticipantSet, numAgents int) (value string) {
-	value = computeNetworkValueStandard(i, agents, numAgents)
-	return value
+// `agentHandler` answers direct messages addressed to an agent.
+// Value requests are served from the agent's private vault.
+func agentHandler(game string, agent string) Handler {
+	return func(from peer.ID, msg Message) (Message, error) {
+		switch msg.Type {
+		case MsgValue:
+			value, err := reader.GetAgentValue(game, agent)
+			if err != nil {
+				return Message{}, err
+			}
+			return Message{Type: MsgValue, From: agent, Payload: []byte(value)}, nil
+		default:
+			return Message{}, fmt.Errorf("unsupported message type %q", msg.Type)
+		}
+	}
 }
 
-// `initDHT` starts a DHT, for use in peer discovery.
-func initDHT(ctx context.Context, h host.Host) *dht.IpfsDHT {
-
-	kademliaDHT, err := dht.New(ctx, h)
-	if err != nil {
-		panic(err)
-	}
-	if err = kademliaDHT.Bootstrap(ctx); err != nil {
-		panic(err)
+// `bootstrapDHT` bootstraps the DHT of a host, for use in peer discovery.
+func bootstrapDHT(ctx context.Context, h host.Host, kademliaDHT *dht.IpfsDHT) error {
+	if err := kademliaDHT.Bootstrap(ctx); err != nil {
+		return err
 	}
 
 	var wg sync.WaitGroup
@@ -82,27 +95,35 @@ func initDHT(ctx context.Context, h host.Host) *dht.IpfsDHT {
 		go func() {
 			defer wg.Done()
 			if err := h.Connect(ctx, *peerinfo); err != nil {
-				fmt.Println("Bootstrap warning:", err)
+				fmt.Fprintln(Progress, "Bootstrap warning:", err)
 			}
 		}()
 	}
 	wg.Wait()
 
-	return kademliaDHT
+	return nil
 }
 
 // `discoverPeers` initializes DHT and Look for others who have
-// announced and attempt to connect to them
-func discoverPeers(ctx context.Context, h host.Host) {
-	kademliaDHT := initDHT(ctx, h)
+// announced the topic of game `game` and attempt to connect to them.
+// It returns once connected to a peer, or when `ctx` is done.
+func discoverPeers(ctx context.Context, h host.Host, kademliaDHT *dht.IpfsDHT, game string, agents []reader.ParticipantSet) error {
+	topicName := topicName(game)
+	if err := bootstrapDHT(ctx, h, kademliaDHT); err != nil {
+		return fmt.Errorf("error in starting the DHT: %w", err)
+	}
 	routingDiscovery := drouting.NewRoutingDiscovery(kademliaDHT)
-	dutil.Advertise(ctx, routingDiscovery, *topicNameFlag)
+	dutil.Advertise(ctx, routingDiscovery, topicName)
 	anyConnected := false
 	for !anyConnected {
-		fmt.Println(h.ID().Pretty(), "is searching for peers...")
-		peerChan, err := routingDiscovery.FindPeers(ctx, *topicNameFlag)
+		fmt.Fprintln(Progress, describePeer(h.ID(), agents), "is searching for peers...")
+		peerChan, err := routingDiscovery.FindPeers(ctx, topicName)
+		// the agent was stopped while searching
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("error in searching for peers: %w", err)
 		}
 		for peer := range peerChan {
 			if peer.ID == h.ID() {
@@ -112,22 +133,85 @@ func discoverPeers(ctx context.Context, h host.Host) {
 			if err != nil {
 				continue
 			} else {
-				fmt.Println(h.ID().Pretty(), " is Connected to:", peer.ID.Pretty())
+				fmt.Fprintln(Progress, describePeer(h.ID(), agents), "is Connected to:", describePeer(peer.ID, agents))
+				emit(Event{TYPE: EventPeerConnected, GAME: game, AGENT: agentOf(h.ID(), agents), PEER: peer.ID.Pretty()})
 				anyConnected = true
 			}
 		}
-		time.Sleep(10 * time.Second)
+		if anyConnected {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
 	}
 
-	fmt.Println("Peer Discovery complete for host", h.ID().Pretty())
+	fmt.Fprintln(Progress, "Peer Discovery complete for host", describePeer(h.ID(), agents))
+	return nil
 }
 
-// `publishTopic` is used by the host to publish a message
-// to the subscribed topic
-func publishTopic(ctx context.Context, topic *pubsub.Topic, value string) {
+// `agentOf` is the name of the agent with peer ID `id`
+func agentOf(id peer.ID, agents []reader.ParticipantSet) string {
+	for _, agent := range agents {
+		if agent.PEERID == id.Pretty() {
+			return agent.USER
+		}
+	}
+	return id.Pretty()
+}
+
+// `describePeer` labels a peer ID with the agent name recorded
+// for it in agents.json
+func describePeer(id peer.ID, agents []reader.ParticipantSet) string {
+	for _, agent := range agents {
+		if agent.PEERID == id.Pretty() {
+			return fmt.Sprintf("%s (%s)", agent.USER, id.Pretty())
+		}
+	}
+	return id.Pretty()
+}
+
+// `publishTopic` is used by the host to publish its current value
+// to the subscribed topic every publishInterval, backing off after
+// errors, until `ctx` is done. A message-sent event is emitted
+// whenever the published value changes.
+func publishTopic(ctx context.Context, topic *pubsub.Topic, game string, agent string, value func() string) {
+	published := false
+	last := ""
+	backoff := time.Duration(0)
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
 	for {
-		if err := topic.Publish(ctx, []byte(value)); err != nil {
-			fmt.Println("### Publish error:", err)
+		current := value()
+		if err := topic.Publish(ctx, []byte(current)); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			backoff *= 2
+			if backoff < publishInterval {
+				backoff = publishInterval
+			} else if backoff > maxPublishBackoff {
+				backoff = maxPublishBackoff
+			}
+			fmt.Fprintln(Progress, "### Publish error:", err, "- retrying in", backoff)
+			ticker.Reset(backoff)
+		} else {
+			if backoff > 0 {
+				backoff = 0
+				ticker.Reset(publishInterval)
+			}
+			if !published || current != last {
+				emit(Event{TYPE: EventMessageSent, GAME: game, AGENT: agent, VALUE: current, DETAIL: "published to the game topic"})
+				published, last = true, current
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 	}
 }
@@ -135,118 +219,176 @@ func publishTopic(ctx context.Context, topic *pubsub.Topic, value string) {
 // `computeNetworkValueExpert` computes network value for the agent
 //  1. read current value from storage(there will always be some value stored at init)
 //  2. if there is data and pub != sub then vote for the new message received
-func computeNetworkValueExpert(h host.Host, ctx context.Context, sub *pubsub.Subscription, agent string, numAgents int) {
-	voteCount := 0
-	// a small in-memory map to keep count of votes from peers.
-	truthMap := make(map[string]int)
-	// a small in-memory agent map to remember all peers who have appeared earlier.
+//  3. if gossip goes quiet for pullAfter, ask the peers of the topic that have not
+//     voted for their value directly over AgentProtocol
+//  4. decide with the aggregation of `values`, keeping the current value if no vote is valid
+//  5. penalize the peers whose value contradicts the decided value
+//
+// It returns early, without a decision, when `ctx` is done.
+func computeNetworkValueExpert(h host.Host, ctx context.Context, ps *pubsub.PubSub, sub *pubsub.Subscription, messenger *Messenger, book *scoreBook, values reader.ValueSpec, game string, agent string, numAgents int) (decided string, received int, voteCount int, err error) {
+	// the values received from peers, in the order they arrived
+	votes := make([]reader.Value, 0)
+	// a small in-memory agent map to remember all peers who have voted earlier.
 	peerMap := make(map[string]int)
-	// get db instance
-	db := reader.GetInstance()
+	// values reported by each author, used for scoring once a value is decided.
+	peerValues := make(map[peer.ID]string)
+	// get the private vault of the agent
+	db, err := reader.GetAgentVault(game, agent)
+	if err != nil {
+		return "", 0, 0, err
+	}
 
-	for {
-		m, err := sub.Next(ctx)
-		if err != nil {
-			continue
+	// `count` counts the vote of peer `from`, unless it has voted
+	// already, and reports whether it did
+	count := func(from peer.ID, recvdValue []byte, via string) bool {
+		// if peer has already communicated earlier..skip it
+		if _, ok := peerMap[from.Pretty()]; ok || from == h.ID() {
+			return false
 		}
-		currentValue, err := db.Get([]byte(agent))
-		if err != nil {
-			continue
+		// update local peerMap
+		peerMap[from.Pretty()] = 1
+		// increase VoteCount
+		voteCount = voteCount + 1
+		// the message carries the value of the peer;
+		// removed agents send an empty vote
+		emit(Event{TYPE: EventMessageReceived, GAME: game, AGENT: agent, PEER: from.Pretty(), VALUE: string(recvdValue), DETAIL: via})
+		if len(recvdValue) == 0 {
+			return true
 		}
-		_, ok := peerMap[m.ReceivedFrom.Pretty()]
-		// if peer has already communicated earlier..continue
-		if ok {
-			continue
+		peerValues[from] = string(recvdValue)
+		// the network decides if the value in the host vault
+		// needs to get updated once every vote is in
+		votes = append(votes, reader.Value(recvdValue))
+		emit(Event{TYPE: EventVoteCounted, GAME: game, AGENT: agent, PEER: from.Pretty(), VALUE: string(recvdValue),
+			DETAIL: fmt.Sprintf("%d of %d votes", voteCount, numAgents-1)})
+		return true
+	}
+
+	// to decide if the corresponding host
+	// received a value that is true or false, we wait till all votes are received and choose
+	// the widely received value
+	for voteCount < numAgents-1 {
+		// messages may still be buffered when the round ends
+		if ctx.Err() != nil {
+			return decided, received, voteCount, nil
 		}
-		// host != peer and peer has not appeared before
-		if h.ID().Pretty() != m.ReceivedFrom.Pretty() {
-			// update local peerMap
-			peerMap[m.ReceivedFrom.Pretty()] = 1
-			// increase VoteCount
-			voteCount = voteCount + 1
-			// Get value of peer from vault
-			recvdValue, err := db.Get([]byte(m.Message.Data))
-			if err != nil {
-				continue
+		nextCtx, cancel := context.WithTimeout(ctx, pullAfter)
+		m, err := sub.Next(nextCtx)
+		cancel()
+		if err != nil {
+			// the round ended or the agent was stopped
+			if ctx.Err() != nil {
+				return decided, received, voteCount, nil
 			}
-			// if received value != value in host vault
-			// network needs to decide if the corresponding host
-			// value needs to get updated or not.
-			// For now, update in memory map frequency
-			if string(currentValue) != string(recvdValue) && string(recvdValue) != "0" {
-				_, ok := truthMap[string(recvdValue)]
-				if ok {
-					truthMap[string(recvdValue)] = truthMap[string(recvdValue)] + 1
-				} else {
-					truthMap[string(recvdValue)] = 0
+			// gossip went quiet, ask the peers that have not voted
+			for _, p := range ps.ListPeers(topicName(game)) {
+				if _, ok := peerMap[p.Pretty()]; ok {
+					continue
+				}
+				reply, err := messenger.Request(ctx, p, Message{Type: MsgValue, From: agent})
+				if err != nil {
+					continue
 				}
+				received++
+				count(p, reply.Payload, "asked directly")
 			}
+			continue
 		}
+		if m.ReceivedFrom != h.ID() {
+			received++
+		}
+		// votes belong to the signed author of the message, not to
+		// the peer that relayed it
+		author, via := m.GetFrom(), ""
+		if m.ReceivedFrom != author {
+			via = "relayed by " + m.ReceivedFrom.Pretty()
+		}
+		if !count(author, m.Message.Data, via) || voteCount == numAgents-1 {
+			continue
+		}
+		// the round may end while the agent waits for more votes
+		select {
+		case <-ctx.Done():
+			return decided, received, voteCount, nil
+		case <-time.After(2 * time.Second):
+		}
+	}
 
-		// to decide if the corresponding host
-		// received a value that is true or false, we wait till all votes are received and choose
-		// the widely received value
-		if voteCount == numAgents-1 {
-			keys := make([]string, 0, len(truthMap))
-
-			for key := range truthMap {
-				keys = append(keys, key)
-			}
-
-			// sort the map to get the network value with highest frequency
-			sort.SliceStable(keys, func(i, j int) bool {
-				return truthMap[keys[i]] > truthMap[keys[j]]
-			})
-
-			for _, k := range keys {
-				// update the agent(host) value with value which got the
-				// highest frequency.
-				// this way all rows in the vault will have the same value which
-				// is the true value.
-				db.Put([]byte(agent), []byte(k))
-				break
+	currentValue, _ := reader.GetAgentValue(game, agent)
+	if k := values.Decide(votes); k != "" {
+		// record the value decided by the aggregation
+		// as the decision of the agent(host).
+		// this way all agents will stand by the same value which
+		// is the true value.
+		// the decision is only recorded if the agent still holds
+		// a value, so that an agent killed meanwhile stays removed
+		err := db.Update(func(tx reader.Tx) error {
+			if _, err := tx.Get([]byte(reader.ValueKey)); err != nil {
+				return err
 			}
-			break
+			return tx.Put([]byte(reader.DecidedKey), []byte(k))
+		})
+		if err != nil {
+			fmt.Fprintln(Progress, h.ID().Pretty(), "could not record its decision:", err)
+		} else {
+			currentValue = string(k)
 		}
-		time.Sleep(2 * time.Second)
 	}
+	penalizeLiars(h, ps, book, peerValues, currentValue)
+	decided = currentValue
+	emit(Event{TYPE: EventValueDecided, GAME: game, AGENT: agent, VALUE: decided})
 
-	fmt.Println(h.ID().Pretty(), "has received votes from all peers")
+	fmt.Fprintln(Progress, h.ID().Pretty(), "has received votes from all peers")
+	return decided, received, voteCount, nil
 }
 
-// `computeNetworkValueStandard` computes network value for the agent in standard mode
-//  1. read current value from storage (there will always be some value stored at init)
-//  2. compare with all other agents and decide
-func computeNetworkValueStandard(id int, agents []reader.ParticipantSet, numAgents int) (k string) {
-	truthMap := make(map[string]int)
-	db := reader.GetInstance()
-	numKeys := db.Len()
-
-	for i := 0; i < numKeys; i++ {
-		agentValue, _ := db.Get([]byte(agents[i].IP))
-		if i == id {
+// `penalizeLiars` lowers the score of every peer whose reported value
+// differs from the decided value. Repeat offenders are blacklisted.
+func penalizeLiars(h host.Host, ps *pubsub.PubSub, book *scoreBook, peerValues map[peer.ID]string, decided string) {
+	for p, value := range peerValues {
+		if value == decided {
 			continue
 		}
-		_, ok := truthMap[string(agentValue)]
-		if ok {
-			truthMap[string(agentValue)] = truthMap[string(agentValue)] + 1
-		} else {
-			truthMap[string(agentValue)] = 0
+		lies := book.penalize(p)
+		fmt.Fprintln(Progress, h.ID().Pretty(), "flagged", p.Pretty(), "as a liar for reporting", value)
+		if lies >= blacklistAfter {
+			ps.BlacklistPeer(p)
+			fmt.Fprintln(Progress, h.ID().Pretty(), "has blacklisted", p.Pretty())
 		}
 	}
-	keys := make([]string, 0, len(truthMap))
-	for key := range truthMap {
-		keys = append(keys, key)
-	}
+}
+
+// `computeNetworkValueStandard` computes network value for the agent in standard mode
+//  1. read own value from the private vault (there will always be some value stored at init)
+//  2. send it to all other agents and collect theirs
+//  3. compare with all other agents and decide
+func computeNetworkValueStandard(ctx context.Context, network *LocalNetwork, game string, id int, agents []reader.ParticipantSet, numAgents int) (reported string, k string, received int) {
+	// the values received, in the order they are processed
+	votes := make([]reader.Value, 0)
+	// a removed agent has no value and sends an empty message
+	reported = network.value(game, agents[id].USER)
+	network.Broadcast(Message{Type: MsgValue, From: agents[id].USER, Payload: []byte(reported)})
+	emit(Event{TYPE: EventMessageSent, GAME: game, AGENT: agents[id].USER, VALUE: reported, DETAIL: "broadcast to all agents"})
 
-	// sort the map to get the network value with highest frequency
-	sort.SliceStable(keys, func(i, j int) bool {
-		return truthMap[keys[i]] > truthMap[keys[j]]
-	})
-	for _, k := range keys {
-		// return top value from cache.
-		return k
+	msgs := network.Collect(ctx, agents[id].USER, numAgents-1)
+	for _, msg := range msgs {
+		emit(Event{TYPE: EventMessageReceived, GAME: game, AGENT: agents[id].USER, PEER: msg.From, VALUE: string(msg.Payload)})
+	}
+	// a crashed agent does not get to decide
+	if network.Crashed(agents[id].USER) {
+		return reported, "", len(msgs)
+	}
+	for i, msg := range msgs {
+		agentValue := msg.Payload
+		if len(agentValue) == 0 {
+			continue
+		}
+		emit(Event{TYPE: EventVoteCounted, GAME: game, AGENT: agents[id].USER, PEER: msg.From, VALUE: string(agentValue),
+			DETAIL: fmt.Sprintf("%d of %d votes", i+1, len(msgs))})
+		votes = append(votes, reader.Value(agentValue))
 	}
 
-	return "-1"
+	// decide with the aggregation of the game, empty if no vote
+	// is a valid value
+	return reported, string(network.spec.Decide(votes)), len(msgs)
 }
@@ -0,0 +1,200 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"liarslie/reader"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// An expert agent that gets no gossip from a peer asks it for its
+// value over AgentProtocol and counts the answer as its vote
+func TestExpertAsksSilentPeersDirectly(t *testing.T) {
+	if err := reader.SetVaultBackend(reader.BackendMemory); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.SetVaultBackend(reader.BackendBitcask)
+	const game = "5e1e7700"
+	for agent, value := range map[string]string{"asker": "3", "silent": "5"} {
+		db, err := reader.GetAgentVault(game, agent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte(reader.ValueKey), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer reader.CloseVaults()
+
+	a, b := newTestHosts(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	psA, err := pubsub.NewGossipSub(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psB, err := pubsub.NewGossipSub(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topicA, err := psA.Join(topicName(game))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subA, err := topicA.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the silent peer joins the topic but never publishes
+	topicB, err := psB.Join(topicName(game))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topicB.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	NewMessenger(b, agentHandler(game, "silent"))
+	messenger := NewMessenger(a, nil)
+	for len(topicA.ListPeers()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("the silent peer did not join the topic")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	book, _ := newScoreBook(a.ID().Pretty(), nil)
+	decided, received, votes, err := computeNetworkValueExpert(a, ctx, psA, subA, messenger, book, reader.DefaultValueSpec, game, "asker", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes != 1 || received != 1 {
+		t.Errorf("counted %d votes of %d messages, want the vote of the silent peer", votes, received)
+	}
+	if decided != "5" {
+		t.Errorf("decided %q, want the value 5 of the silent peer", decided)
+	}
+}
+
+// In the line liar - relay - judge - honest the judge only hears
+// the liar through the relay. The vote and the penalty go to the
+// liar, who wrote the message, and not to the relay.
+func TestExpertCountsVotesOfAuthors(t *testing.T) {
+	if err := reader.SetVaultBackend(reader.BackendMemory); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.SetVaultBackend(reader.BackendBitcask)
+	const game = "1e1a7000"
+	db, err := reader.GetAgentVault(game, "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte(reader.ValueKey), []byte("5")); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.CloseVaults()
+
+	liar, relay, judge, honest := newTestHost(t), newTestHost(t), newTestHost(t), newTestHost(t)
+	connectHosts(t, liar, relay)
+	connectHosts(t, relay, judge)
+	connectHosts(t, judge, honest)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	topics := make(map[host.Host]*pubsub.Topic)
+	var psJudge *pubsub.PubSub
+	var subJudge *pubsub.Subscription
+	for _, h := range []host.Host{liar, relay, judge, honest} {
+		ps, err := pubsub.NewGossipSub(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic, err := ps.Join(topicName(game))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub, err := topic.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		topics[h] = topic
+		if h == judge {
+			psJudge, subJudge = ps, sub
+		}
+	}
+	// every agent but the judge keeps publishing its value
+	for h, value := range map[host.Host]string{liar: "9", relay: "5", honest: "5"} {
+		go func(topic *pubsub.Topic, value string) {
+			for ctx.Err() == nil {
+				topic.Publish(ctx, []byte(value))
+				select {
+				case <-ctx.Done():
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+		}(topics[h], value)
+	}
+
+	book, _ := newScoreBook(judge.ID().Pretty(), nil)
+	decided, _, votes, err := computeNetworkValueExpert(judge, ctx, psJudge, subJudge, NewMessenger(judge, nil), book, reader.DefaultValueSpec, game, "judge", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes != 3 {
+		t.Fatalf("counted %d votes, want one of each other agent", votes)
+	}
+	if decided != "5" {
+		t.Errorf("decided %q, want 5", decided)
+	}
+	if lies := book.lies[liar.ID()]; lies != 1 {
+		t.Errorf("the liar has %d lies, want 1", lies)
+	}
+	if lies := book.lies[relay.ID()]; lies != 0 {
+		t.Errorf("the relay has %d lies, want none", lies)
+	}
+}
+
+// An agent publishes its value every publishInterval, and backs off
+// when publishing fails
+func TestPublishTopicIsPaced(t *testing.T) {
+	h := newTestHost(t)
+	ps, err := pubsub.NewGossipSub(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := ps.Join("paced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := 0
+	ctx, cancel := context.WithTimeout(context.Background(), 3*publishInterval/2)
+	defer cancel()
+	publishTopic(ctx, topic, "", "agent", func() string { reads++; return "5" })
+	if reads != 2 {
+		t.Errorf("published %d times in 1.5 intervals, want 2", reads)
+	}
+
+	closed, err := ps.Join("closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var progress bytes.Buffer
+	Progress = &progress
+	defer func() { Progress = os.Stdout }()
+	ctx, cancel = context.WithTimeout(context.Background(), 4*publishInterval)
+	defer cancel()
+	publishTopic(ctx, closed, "", "agent", func() string { return "5" })
+	// after 0, 1 and 3 intervals
+	if errors := strings.Count(progress.String(), "Publish error"); errors != 3 {
+		t.Errorf("%d publish errors in 4 intervals, want 3:\n%s", errors, progress.String())
+	}
+}
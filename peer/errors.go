@@ -0,0 +1,102 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNoPeers is returned when an agent finds no peer of its game
+	// within the discovery timeout
+	ErrNoPeers = errors.New("no peers found")
+	// ErrQuorumNotReached is returned when an agent does not hear
+	// from every peer within the round timeout
+	ErrQuorumNotReached = errors.New("quorum not reached")
+	// ErrTimeout is returned when the deadline of the caller passes
+	// before the agent is done
+	ErrTimeout = errors.New("timed out")
+	// ErrAgentStopped is returned for rounds of an agent that was
+	// stopped while it played
+	ErrAgentStopped = errors.New("agent stopped")
+)
+
+// Timeouts bound the phases of an expert round. Zero leaves a phase
+// unbounded.
+type Timeouts struct {
+	// DISCOVERY bounds the search for a first peer of the game
+	DISCOVERY time.Duration
+	// ROUND bounds the wait for the votes of every peer
+	ROUND time.Duration
+}
+
+// DefaultTimeouts are used by rounds that do not set their own
+var DefaultTimeouts = Timeouts{DISCOVERY: time.Minute, ROUND: 2 * time.Minute}
+
+// errorKinds name the typed errors carried by the control API
+var errorKinds = map[string]error{
+	"no-peers": ErrNoPeers,
+	"quorum":   ErrQuorumNotReached,
+	"timeout":  ErrTimeout,
+	"stopped":  ErrAgentStopped,
+}
+
+// `kindOf` names the typed error `err` wraps, if any
+func kindOf(err error) string {
+	for kind, typed := range errorKinds {
+		if errors.Is(err, typed) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// remoteError is a typed error reported by an agent daemon
+type remoteError struct {
+	message string
+	typed   error
+}
+
+func (e remoteError) Error() string {
+	return e.message
+}
+
+func (e remoteError) Unwrap() error {
+	return e.typed
+}
+
+// timeoutError is ErrTimeout caused by the deadline of a context.
+// It matches both ErrTimeout and context.DeadlineExceeded.
+type timeoutError struct {
+	cause error
+}
+
+func (e timeoutError) Error() string {
+	return ErrTimeout.Error() + ": " + e.cause.Error()
+}
+
+func (e timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e timeoutError) Unwrap() error {
+	return e.cause
+}
+
+// `ContextError` is the error of done context `ctx`, an ErrTimeout
+// if its deadline passed
+func ContextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutError{cause: ctx.Err()}
+	}
+	return ctx.Err()
+}
+
+// `withTimeout` derives a context from `ctx` bounded by `timeout`,
+// or only cancellable if `timeout` is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
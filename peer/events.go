@@ -0,0 +1,171 @@
+package peer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// types of the events agents emit while they play
+const (
+	EventPeerConnected   = "peer-connected"
+	EventMessageSent     = "message-sent"
+	EventMessageReceived = "message-received"
+	EventVoteCounted     = "vote-counted"
+	EventValueDecided    = "value-decided"
+	EventFaultInjected   = "fault-injected"
+	EventValueObserved   = "value-observed"
+)
+
+// Event is something that happened to AGENT of GAME. PEER is the
+// other side of a message or connection: an agent name in standard
+// mode and a peer ID in expert mode.
+type Event struct {
+	TIME   time.Time
+	TYPE   string
+	GAME   string
+	AGENT  string `json:",omitempty"`
+	PEER   string `json:",omitempty"`
+	VALUE  string `json:",omitempty"`
+	DETAIL string `json:",omitempty"`
+}
+
+// EventBus delivers events to every subscriber. Subscribers that
+// do not keep up miss events rather than slowing the agents down.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+// Events is the event bus of the process
+var Events = NewEventBus()
+
+// `NewEventBus` creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]bool)}
+}
+
+// `Publish` delivers `event` to the subscribers of the bus
+func (b *EventBus) Publish(event Event) {
+	if event.TIME.IsZero() {
+		event.TIME = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// `Subscribe` returns a channel receiving the events published from
+// now on, holding up to `buffer` of them, and a function that ends
+// the subscription and closes the channel
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// `emit` publishes an event on the event bus of the process
+func emit(event Event) {
+	Events.Publish(event)
+}
+
+// `ServeEvents` streams the events of game `game` as server-sent
+// events, one JSON event per message, until the client goes away or
+// `done` is closed. An empty `game` streams the events of every game.
+func ServeEvents(w http.ResponseWriter, r *http.Request, game string, done <-chan struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := Events.Subscribe(1024)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// keep idle connections alive through proxies
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if game != "" && event.GAME != game {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.TYPE, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// `WatchEvents` reads the server-sent events at `url` with `client`
+// and calls `fn` for each of them until the stream ends or `ctx` is
+// done
+func WatchEvents(ctx context.Context, client *http.Client, url string, fn func(Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			continue
+		}
+		fn(event)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
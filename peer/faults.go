@@ -0,0 +1,23 @@
+package peer
+
+import "liarslie/reader"
+
+// `KillAgent` removes the value of agent `agent` of game `game` from
+// its vault, see `reader.KillAgent`, and reports it as a fault
+func KillAgent(game string, agent string) error {
+	if err := reader.KillAgent(game, agent); err != nil {
+		return err
+	}
+	emit(Event{TYPE: EventFaultInjected, GAME: game, AGENT: agent, DETAIL: "kill"})
+	return nil
+}
+
+// `ObserveValue` makes agent `agent` of game `game` observe `value`,
+// see `reader.ObserveValue`, and reports it
+func ObserveValue(game string, agent string, value string) error {
+	if err := reader.ObserveValue(game, agent, value); err != nil {
+		return err
+	}
+	emit(Event{TYPE: EventValueObserved, GAME: game, AGENT: agent, VALUE: value})
+	return nil
+}
@@ -0,0 +1,189 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"liarslie/reader"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// watchPoll is how often a command pushing events looks for
+	// watchers that started after it
+	watchPoll = 200 * time.Millisecond
+	// pushDrain bounds how long a command waits for its watchers
+	// to take its last events when it ends
+	pushDrain = 5 * time.Second
+)
+
+// errWatcherGone ends the pushes to a watcher that went away
+var errWatcherGone = errors.New("watcher is gone")
+
+// `watchSocket` is the Unix socket on which process `pid` watches
+// the events of game `game`
+func watchSocket(game string, pid int) string {
+	return filepath.Join(reader.RunDir(game), fmt.Sprintf("watch-%d.sock", pid))
+}
+
+// `watchSockets` are the sockets of every watcher of game `game`
+func watchSockets(game string) []string {
+	sockets, _ := filepath.Glob(filepath.Join(reader.RunDir(game), "watch-*.sock"))
+	return sockets
+}
+
+// `ListenEvents` calls `fn` for every event of game `game` pushed by
+// the commands playing its rounds, see `PushEvents`, until `ctx` is
+// done. The events are pushed to a Unix socket of this process in
+// the run directory of the game.
+func ListenEvents(ctx context.Context, game string, fn func(Event)) error {
+	socket := watchSocket(game, os.Getpid())
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return err
+	}
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		dec := json.NewDecoder(r.Body)
+		for {
+			var event Event
+			if err := dec.Decode(&event); err != nil {
+				return
+			}
+			fn(event)
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// `PushEvents` pushes the events of game `game` published in this
+// process to the watchers of the game, see `ListenEvents`, so that
+// commands such as `extend` can be followed by `watch`. Watchers
+// starting later are picked up as they appear. The returned function
+// ends the pushes once the watchers have taken the events so far.
+func PushEvents(game string) func() {
+	events, unsubscribe := Events.Subscribe(1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var pushes sync.WaitGroup
+		// watchers by socket, nil once they went away
+		watchers := make(map[string]*io.PipeWriter)
+		attach := func() {
+			for _, socket := range watchSockets(game) {
+				if _, ok := watchers[socket]; !ok {
+					watchers[socket] = pushTo(socket, &pushes)
+				}
+			}
+		}
+		defer func() {
+			for _, w := range watchers {
+				if w != nil {
+					w.Close()
+				}
+			}
+			waitTimeout(&pushes, pushDrain)
+		}()
+
+		attach()
+		ticker := time.NewTicker(watchPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				attach()
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.GAME != game {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				for socket, w := range watchers {
+					if w == nil {
+						continue
+					}
+					if _, err := w.Write(append(data, '\n')); err != nil {
+						watchers[socket] = nil
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			<-done
+		})
+	}
+}
+
+// `pushTo` streams what is written to the returned pipe to the
+// watcher listening on `socket`. Writes fail once the watcher is
+// gone, or was never there.
+func pushTo(socket string, pushes *sync.WaitGroup) *io.PipeWriter {
+	r, w := io.Pipe()
+	dialer := net.Dialer{Timeout: time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	pushes.Add(1)
+	go func() {
+		defer pushes.Done()
+		defer transport.CloseIdleConnections()
+		req, err := http.NewRequest(http.MethodPost, "http://watch/events", r)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = (&http.Client{Transport: transport}).Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		r.CloseWithError(errWatcherGone)
+	}()
+	return w
+}
+
+// `waitTimeout` waits for `wg`, at most for `timeout`
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) {
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(timeout):
+	}
+}
@@ -0,0 +1,72 @@
+package peer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// `inTempDir` runs the test in a temporary working directory, which
+// holds the run directories of its games
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// A watcher receives every event of its game published by commands
+// playing rounds, even rounds ending right away, command after
+// command
+func TestPushEvents(t *testing.T) {
+	inTempDir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan Event, 16)
+	listening := make(chan error, 1)
+	go func() {
+		listening <- ListenEvents(ctx, "feed0001", func(event Event) { events <- event })
+	}()
+	for deadline := time.Now().Add(5 * time.Second); len(watchSockets("feed0001")) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the watcher did not listen")
+		}
+	}
+	// a watcher that went away leaves its socket behind
+	if err := ioutil.WriteFile(watchSocket("feed0001", 0), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for command := 0; command < 2; command++ {
+		stop := PushEvents("feed0001")
+		emit(Event{TYPE: EventValueDecided, GAME: "other", AGENT: "a", VALUE: "3"})
+		emit(Event{TYPE: EventValueDecided, GAME: "feed0001", AGENT: "a", VALUE: "5"})
+		emit(Event{TYPE: EventValueDecided, GAME: "feed0001", AGENT: "b", VALUE: "5"})
+		stop()
+		for _, agent := range []string{"a", "b"} {
+			select {
+			case event := <-events:
+				if event.GAME != "feed0001" || event.AGENT != agent {
+					t.Errorf("command %d: watched %+v, want the decision of %s", command, event, agent)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("command %d: the decision of %s was not watched", command, agent)
+			}
+		}
+	}
+
+	cancel()
+	if err := <-listening; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(watchSocket("feed0001", os.Getpid())); !os.IsNotExist(err) {
+		t.Error("the watcher left its socket behind")
+	}
+}
@@ -0,0 +1,190 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"liarslie/reader"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LocalNetwork delivers messages between agents running in the
+// same process. Standard mode uses it instead of libp2p, so that
+// agents still learn each other's values only through messages.
+// Scenarios can partition the network and crash agents; messages
+// that cannot be delivered are dropped.
+type LocalNetwork struct {
+	game    string
+	mu      sync.RWMutex
+	inboxes map[string]chan Message
+	// side of the partition each agent is on, 0 when not partitioned
+	sides   map[string]int
+	crashed map[string]bool
+	// values of agents whose vault is held by their daemon
+	values  map[string]string
+	timeout time.Duration
+	// seed of the order in which agents process their messages
+	seed int64
+	// spec of the values agents decide on
+	spec reader.ValueSpec
+}
+
+// `NewLocalNetwork` creates an inbox for every agent of game `game`.
+// Each inbox can hold one message from every other agent without
+// blocking. `seed` decides the order in which each agent processes
+// its messages.
+func NewLocalNetwork(game string, agents []reader.ParticipantSet, seed int64) (*LocalNetwork, error) {
+	spec, err := reader.GetValueSpec(game)
+	if err != nil {
+		return nil, err
+	}
+	network := &LocalNetwork{
+		game:    game,
+		inboxes: make(map[string]chan Message),
+		sides:   make(map[string]int),
+		crashed: make(map[string]bool),
+		values:  make(map[string]string),
+		seed:    seed,
+		spec:    spec,
+	}
+	for _, agent := range agents {
+		network.inboxes[agent.USER] = make(chan Message, len(agents))
+	}
+	return network, nil
+}
+
+// `SetTimeout` bounds how long `Collect` waits for messages.
+// Zero, the default, waits until all messages arrived.
+func (n *LocalNetwork) SetTimeout(timeout time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.timeout = timeout
+}
+
+// `SetValue` makes agent `agent` report `value` instead of reading
+// its vault, for agents running as a daemon, which holds the vault
+func (n *LocalNetwork) SetValue(agent string, value string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.values[agent] = value
+}
+
+// `value` is the value agent `agent` of game `game` reports
+func (n *LocalNetwork) value(game string, agent string) string {
+	n.mu.RLock()
+	value, ok := n.values[agent]
+	n.mu.RUnlock()
+	if !ok {
+		value, _ = reader.GetAgentValue(game, agent)
+	}
+	return value
+}
+
+// `Partition` splits the network so that only agents on the same
+// side can reach each other. Agents not listed form a side of
+// their own.
+func (n *LocalNetwork) Partition(sides [][]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sides = make(map[string]int)
+	for i, side := range sides {
+		for _, agent := range side {
+			n.sides[agent] = i + 1
+		}
+	}
+	emit(Event{TYPE: EventFaultInjected, GAME: n.game, DETAIL: fmt.Sprintf("partition into %d sides", len(sides))})
+}
+
+// `Heal` removes any partition
+func (n *LocalNetwork) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sides = make(map[string]int)
+	emit(Event{TYPE: EventFaultInjected, GAME: n.game, DETAIL: "partition healed"})
+}
+
+// `Crash` takes agent `agent` off the network. It neither sends
+// nor receives messages from then on.
+func (n *LocalNetwork) Crash(agent string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.crashed[agent] = true
+	emit(Event{TYPE: EventFaultInjected, GAME: n.game, AGENT: agent, DETAIL: "crash"})
+}
+
+// `Crashed` reports whether agent `agent` has crashed
+func (n *LocalNetwork) Crashed(agent string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.crashed[agent]
+}
+
+// `Send` delivers `msg` to agent `to`
+func (n *LocalNetwork) Send(to string, msg Message) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.crashed[to] || n.crashed[msg.From] || n.sides[to] != n.sides[msg.From] {
+		return
+	}
+	if inbox, ok := n.inboxes[to]; ok {
+		inbox <- msg
+	}
+}
+
+// `Broadcast` delivers `msg` to every agent except its sender
+func (n *LocalNetwork) Broadcast(msg Message) {
+	for to := range n.inboxes {
+		if to != msg.From {
+			n.Send(to, msg)
+		}
+	}
+}
+
+// `Collect` waits for `count` messages addressed to agent `agent`,
+// or until the timeout of the network expires or `ctx` is done. The
+// messages are returned in an order drawn from the seed of the
+// network rather than the order in which the goroutines of the
+// senders ran.
+func (n *LocalNetwork) Collect(ctx context.Context, agent string, count int) []Message {
+	msgs := make([]Message, 0, count)
+	inbox := n.inboxes[agent]
+	n.mu.RLock()
+	timeout := n.timeout
+	n.mu.RUnlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for len(msgs) < count {
+		select {
+		case msg := <-inbox:
+			msgs = append(msgs, msg)
+		case <-expired:
+			return n.schedule(agent, msgs)
+		case <-ctx.Done():
+			return n.schedule(agent, msgs)
+		}
+	}
+	return n.schedule(agent, msgs)
+}
+
+// `schedule` orders the messages of agent `agent` by sender, then
+// shuffles them with a source derived from the seed and the agent
+func (n *LocalNetwork) schedule(agent string, msgs []Message) []Message {
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].From < msgs[j].From
+	})
+	h := fnv.New64a()
+	h.Write([]byte(agent))
+	rng := rand.New(rand.NewSource(n.seed ^ int64(h.Sum64())))
+	rng.Shuffle(len(msgs), func(i, j int) {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	})
+	return msgs
+}
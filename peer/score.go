@@ -0,0 +1,204 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"liarslie/reader"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// liarPenalty is subtracted from the application specific
+	// score of a peer each time it contradicts the decided value
+	liarPenalty = 50
+	// blacklistAfter is the number of contradictions after which
+	// a peer is blacklisted outright
+	blacklistAfter = 3
+	// scoreInspectPeriod is how often peer scores are inspected
+	scoreInspectPeriod = time.Second
+	// liesKeyPrefix prefixes the keys of the vault of an agent that
+	// count the contradictions of each of its peers, so that scores
+	// outlive the agent, which may be stopped and started again
+	// between rounds
+	liesKeyPrefix = "lies/"
+)
+
+// scoreThresholds are the GossipSub thresholds used by every agent.
+// Two contradictions are enough to push a peer below the graylist
+// threshold, after which its RPCs are ignored.
+var scoreThresholds = &pubsub.PeerScoreThresholds{
+	GossipThreshold:             -10,
+	PublishThreshold:            -50,
+	GraylistThreshold:           -80,
+	AcceptPXThreshold:           10,
+	OpportunisticGraftThreshold: 5,
+}
+
+// scoreBook keeps track of peers that contradicted the decided
+// value, as seen by a single agent over all of its rounds
+type scoreBook struct {
+	mu         sync.Mutex
+	host       string
+	lies       map[peer.ID]int
+	graylisted map[peer.ID]bool
+	// vault keeps the contradictions, nil if they are not kept
+	vault reader.Vault
+}
+
+// `newScoreBook` creates a score book for host `host` with the
+// contradictions kept in `vault` by earlier rounds. A nil vault
+// starts an empty book that is not kept.
+func newScoreBook(host string, vault reader.Vault) (*scoreBook, error) {
+	b := &scoreBook{
+		host:       host,
+		lies:       make(map[peer.ID]int),
+		graylisted: make(map[peer.ID]bool),
+		vault:      vault,
+	}
+	if vault == nil {
+		return b, nil
+	}
+	err := vault.Iterate(func(key []byte, value []byte) error {
+		if !strings.HasPrefix(string(key), liesKeyPrefix) {
+			return nil
+		}
+		p, err := peer.Decode(strings.TrimPrefix(string(key), liesKeyPrefix))
+		if err != nil {
+			return fmt.Errorf("bad peer in %s: %w", key, err)
+		}
+		if b.lies[p], err = strconv.Atoi(string(value)); err != nil {
+			return fmt.Errorf("bad count of %s: %w", key, err)
+		}
+		return nil
+	})
+	return b, err
+}
+
+// `appScore` is the application specific score of peer `p`
+func (b *scoreBook) appScore(p peer.ID) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return -liarPenalty * float64(b.lies[p])
+}
+
+// `penalize` records a contradiction by peer `p` and returns
+// the total number of contradictions seen so far, in this and
+// earlier rounds. The count is kept in the vault without holding
+// the book, which the score loop of GossipSub reads.
+func (b *scoreBook) penalize(p peer.ID) int {
+	b.mu.Lock()
+	b.lies[p]++
+	lies := b.lies[p]
+	b.mu.Unlock()
+	if b.vault == nil {
+		return lies
+	}
+
+	kept, err := b.keepLie(p)
+	if err != nil {
+		fmt.Fprintln(Progress, b.host, "could not keep the score of", p.Pretty(), "-", err)
+		return lies
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// books sharing the vault may have counted more contradictions
+	if kept > b.lies[p] {
+		b.lies[p] = kept
+	}
+	return b.lies[p]
+}
+
+// `keepLie` adds a contradiction of peer `p` to the count kept in
+// the vault and returns the new count. The count is swapped in, so
+// that books sharing the vault never lose a contradiction.
+func (b *scoreBook) keepLie(p peer.ID) (int, error) {
+	key := []byte(liesKeyPrefix + p.Pretty())
+	for {
+		lies := 0
+		old, err := b.vault.Get(key)
+		if errors.Is(err, reader.ErrKeyNotFound) {
+			old = nil
+		} else if err != nil {
+			return 0, err
+		} else if lies, err = strconv.Atoi(string(old)); err != nil {
+			return 0, fmt.Errorf("bad count of %s: %w", key, err)
+		}
+		swapped, err := b.vault.CompareAndSwap(key, old, []byte(strconv.Itoa(lies+1)))
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return lies + 1, nil
+		}
+	}
+}
+
+// `blacklisted` are the peers that contradicted the decided value
+// often enough to be blacklisted
+func (b *scoreBook) blacklisted() []peer.ID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var peers []peer.ID
+	for p, lies := range b.lies {
+		if lies >= blacklistAfter {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// `inspect` reports peers as they cross the graylist threshold
+// and when they recover from it
+func (b *scoreBook) inspect(scores map[peer.ID]float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for p, score := range scores {
+		below := score < scoreThresholds.GraylistThreshold
+		if below && !b.graylisted[p] {
+			fmt.Fprintln(Progress, b.host, "has graylisted", p.Pretty(), "with score", score)
+		} else if !below && b.graylisted[p] {
+			fmt.Fprintln(Progress, b.host, "has lifted graylist for", p.Pretty(), "with score", score)
+		}
+		b.graylisted[p] = below
+	}
+}
+
+// `scoreOptions` returns the GossipSub options enabling peer
+// scoring on topic `topic` backed by the score book
+func scoreOptions(topic string, book *scoreBook) []pubsub.Option {
+	params := &pubsub.PeerScoreParams{
+		Topics: map[string]*pubsub.TopicScoreParams{
+			topic: {
+				TopicWeight:                    1,
+				TimeInMeshWeight:               0.01,
+				TimeInMeshQuantum:              time.Second,
+				TimeInMeshCap:                  10,
+				FirstMessageDeliveriesWeight:   1,
+				FirstMessageDeliveriesDecay:    pubsub.ScoreParameterDecay(time.Minute),
+				FirstMessageDeliveriesCap:      10,
+				InvalidMessageDeliveriesWeight: -10,
+				InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+			},
+		},
+		AppSpecificScore:  book.appScore,
+		AppSpecificWeight: 1,
+		// all agents share the loopback address, so colocation
+		// must not count against them
+		IPColocationFactorWeight: 0,
+		DecayInterval:            time.Second,
+		DecayToZero:              0.01,
+		RetainScore:              time.Hour,
+	}
+
+	return []pubsub.Option{
+		pubsub.WithPeerScore(params, scoreThresholds),
+		pubsub.WithPeerScoreInspect(pubsub.PeerScoreInspectFn(book.inspect), scoreInspectPeriod),
+		pubsub.WithBlacklist(pubsub.NewMapBlacklist()),
+	}
+}
@@ -0,0 +1,129 @@
+package peer
+
+import (
+	"liarslie/reader"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxTopicScore is the highest topic score of scoreOptions: capped
+// first deliveries plus capped time in the mesh
+const maxTopicScore = 10*1 + 10*0.01
+
+// `testPeer` is a random peer ID
+func testPeer(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// An expert agent may be stopped and started again between rounds.
+// A liar contradicting the decided value once per round is
+// graylisted in its second round and blacklisted in its third,
+// even with the best topic score.
+func TestLiarIsIsolatedOverRounds(t *testing.T) {
+	inTempDir(t)
+	defer reader.CloseVaults()
+	liar, honest := testPeer(t), testPeer(t)
+
+	for round := 1; round <= blacklistAfter; round++ {
+		vault, err := reader.GetAgentVault("5c0e5000", "judge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		book, err := newScoreBook("judge", vault)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lies := book.penalize(liar); lies != round {
+			t.Fatalf("round %d: the liar has %d lies, want %d", round, lies, round)
+		}
+		book.inspect(map[peer.ID]float64{
+			liar:   book.appScore(liar) + maxTopicScore,
+			honest: book.appScore(honest) + maxTopicScore,
+		})
+
+		if got, want := book.graylisted[liar], round >= 2; got != want {
+			t.Errorf("round %d: liar graylisted %t, want %t", round, got, want)
+		}
+		if book.graylisted[honest] {
+			t.Errorf("round %d: the honest peer is graylisted", round)
+		}
+		blacklisted := book.blacklisted()
+		if got, want := len(blacklisted) == 1 && blacklisted[0] == liar, round >= blacklistAfter; got != want {
+			t.Errorf("round %d: blacklisted %v, want the liar %t", round, blacklisted, want)
+		}
+		// the agent is stopped at the end of the round
+		if err := reader.CloseAgentVault("5c0e5000", "judge"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// slowVault blocks compare-and-swaps until they are released
+type slowVault struct {
+	reader.Vault
+	swapping chan struct{}
+	release  chan struct{}
+}
+
+func (v slowVault) CompareAndSwap(key []byte, old []byte, new []byte) (bool, error) {
+	v.swapping <- struct{}{}
+	<-v.release
+	return v.Vault.CompareAndSwap(key, old, new)
+}
+
+// Scores are read while a contradiction is being kept in the vault
+func TestScoreBookKeepsLiesUnlocked(t *testing.T) {
+	vault, err := reader.OpenVault(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	slow := slowVault{Vault: vault, swapping: make(chan struct{}), release: make(chan struct{})}
+	book, err := newScoreBook("judge", slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liar := testPeer(t)
+	penalized := make(chan int)
+	go func() { penalized <- book.penalize(liar) }()
+	<-slow.swapping
+
+	scored := make(chan float64)
+	go func() { scored <- book.appScore(liar) }()
+	select {
+	case score := <-scored:
+		if score != -liarPenalty {
+			t.Errorf("score %v while the lie is kept, want %v", score, float64(-liarPenalty))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the score could not be read while the lie was kept")
+	}
+	close(slow.release)
+	if lies := <-penalized; lies != 1 {
+		t.Errorf("%d lies, want 1", lies)
+	}
+}
+
+func TestScoreBookWithoutVault(t *testing.T) {
+	book, err := newScoreBook("judge", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liar := testPeer(t)
+	book.penalize(liar)
+	if score := book.appScore(liar); score != -liarPenalty {
+		t.Errorf("score %v after one lie, want %v", score, float64(-liarPenalty))
+	}
+}
@@ -0,0 +1,221 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"liarslie/reader"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio"
+)
+
+// AgentProtocol is the protocol ID for direct point-to-point
+// messages between agents
+const AgentProtocol = protocol.ID("/liarslie/agent/1.0.0")
+
+const (
+	// streamTimeout bounds how long a single send or request
+	// may take, including opening the stream
+	streamTimeout = 10 * time.Second
+	// maxMessageSize bounds a frame. It holds the largest value of
+	// a game as a base64 payload, plus frameEnvelope for the rest.
+	maxMessageSize = (reader.MaxFactsSize+2)/3*4 + frameEnvelope
+	// frameEnvelope bounds the JSON of a frame around its payload
+	frameEnvelope = 1 << 10
+)
+
+// frame kinds used on the wire
+const (
+	frameSend     = "send"
+	frameRequest  = "request"
+	frameResponse = "response"
+	frameError    = "error"
+)
+
+// message types understood by agents
+const (
+	// MsgValue asks a peer for the value it currently holds
+	MsgValue = "value"
+)
+
+// Message is the payload exchanged over AgentProtocol
+type Message struct {
+	Type    string
+	From    string
+	Payload []byte
+}
+
+// frame wraps a Message with the framing information needed to
+// tell one-way sends, requests and responses apart
+type frame struct {
+	Kind    string
+	Message Message
+	Error   string `json:",omitempty"`
+}
+
+// Handler processes an incoming message from `from`.
+// For requests the returned message is sent back as the response;
+// for one-way sends it is ignored.
+type Handler func(from peer.ID, msg Message) (Message, error)
+
+// Messenger is a small client for AgentProtocol bound to a host
+type Messenger struct {
+	host    host.Host
+	handler Handler
+}
+
+// `NewMessenger` registers AgentProtocol on the host and
+// returns a client that can send messages to other agents
+func NewMessenger(h host.Host, handler Handler) *Messenger {
+	m := &Messenger{host: h, handler: handler}
+	h.SetStreamHandler(AgentProtocol, m.handleStream)
+	return m
+}
+
+// `Send` delivers a one-way message to peer `p`, giving up when
+// `ctx` is done
+func (m *Messenger) Send(ctx context.Context, p peer.ID, msg Message) error {
+	s, done, err := m.openStream(ctx, p)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return streamError(ctx, writeFrame(s, frame{Kind: frameSend, Message: msg}))
+}
+
+// `Request` sends a message to peer `p` and waits for its response,
+// giving up when `ctx` is done
+func (m *Messenger) Request(ctx context.Context, p peer.ID, msg Message) (Message, error) {
+	s, done, err := m.openStream(ctx, p)
+	if err != nil {
+		return Message{}, err
+	}
+	defer done()
+
+	if err := writeFrame(s, frame{Kind: frameRequest, Message: msg}); err != nil {
+		return Message{}, streamError(ctx, err)
+	}
+	if err := s.CloseWrite(); err != nil {
+		return Message{}, streamError(ctx, err)
+	}
+
+	f, err := readFrame(s)
+	if err != nil {
+		return Message{}, streamError(ctx, err)
+	}
+	switch f.Kind {
+	case frameResponse:
+		return f.Message, nil
+	case frameError:
+		return Message{}, errors.New(f.Error)
+	default:
+		return Message{}, fmt.Errorf("unexpected frame %q in response", f.Kind)
+	}
+}
+
+// `Close` removes the AgentProtocol handler from the host
+func (m *Messenger) Close() {
+	m.host.RemoveStreamHandler(AgentProtocol)
+}
+
+// `openStream` opens a new AgentProtocol stream that lasts at most
+// streamTimeout and is reset when `ctx` is done. `done` closes the
+// stream.
+func (m *Messenger) openStream(ctx context.Context, p peer.ID) (s network.Stream, done func(), err error) {
+	streamCtx, cancel := context.WithTimeout(ctx, streamTimeout)
+	s, err = m.host.NewStream(streamCtx, p, AgentProtocol)
+	if err != nil {
+		cancel()
+		return nil, nil, streamError(ctx, err)
+	}
+	if err := s.SetDeadline(time.Now().Add(streamTimeout)); err != nil {
+		cancel()
+		s.Reset()
+		return nil, nil, err
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		select {
+		case <-streamCtx.Done():
+			s.Reset()
+		case <-closed:
+		}
+	}()
+	return s, func() {
+		close(closed)
+		cancel()
+		s.Close()
+	}, nil
+}
+
+// `streamError` is the error of done context `ctx` in place of
+// `err`, which is then caused by the stream being reset
+func streamError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ContextError(ctx)
+	}
+	return err
+}
+
+// `handleStream` reads a single frame from an incoming stream,
+// dispatches it to the handler and answers requests
+func (m *Messenger) handleStream(s network.Stream) {
+	defer s.Close()
+	if err := s.SetDeadline(time.Now().Add(streamTimeout)); err != nil {
+		s.Reset()
+		return
+	}
+
+	f, err := readFrame(s)
+	if err != nil {
+		s.Reset()
+		return
+	}
+	if m.handler == nil {
+		return
+	}
+
+	resp, err := m.handler(s.Conn().RemotePeer(), f.Message)
+	if f.Kind != frameRequest {
+		return
+	}
+	if err != nil {
+		writeFrame(s, frame{Kind: frameError, Error: err.Error()})
+		return
+	}
+	writeFrame(s, frame{Kind: frameResponse, Message: resp})
+}
+
+// `writeFrame` writes a varint length-prefixed frame to the stream
+func writeFrame(s network.Stream, f frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds limit of %d bytes", len(data), maxMessageSize)
+	}
+	return msgio.NewVarintWriter(s).WriteMsg(data)
+}
+
+// `readFrame` reads a varint length-prefixed frame from the stream
+func readFrame(s network.Stream) (frame, error) {
+	var f frame
+	r := msgio.NewVarintReaderSize(s, maxMessageSize)
+	data, err := r.ReadMsg()
+	if err != nil {
+		return f, err
+	}
+	defer r.ReleaseMsg(data)
+
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
@@ -0,0 +1,140 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"liarslie/reader"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// `newTestHost` starts a host on the loopback interface
+func newTestHost(t *testing.T) host.Host {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// `connectHosts` connects host `a` to host `b`
+func connectHosts(t *testing.T, a, b host.Host) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// `newTestHosts` starts two connected hosts on the loopback interface
+func newTestHosts(t *testing.T) (host.Host, host.Host) {
+	t.Helper()
+	a, b := newTestHost(t), newTestHost(t)
+	connectHosts(t, a, b)
+	return a, b
+}
+
+func TestMessengerRequest(t *testing.T) {
+	a, b := newTestHosts(t)
+	NewMessenger(b, func(from peer.ID, msg Message) (Message, error) {
+		if from != a.ID() {
+			t.Errorf("request from %s, want %s", from, a.ID())
+		}
+		if msg.Type != MsgValue {
+			return Message{}, errors.New("unsupported")
+		}
+		return Message{Type: MsgValue, From: "b", Payload: []byte("5")}, nil
+	})
+	messenger := NewMessenger(a, nil)
+	defer messenger.Close()
+
+	reply, err := messenger.Request(context.Background(), b.ID(), Message{Type: MsgValue, From: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.From != "b" || string(reply.Payload) != "5" {
+		t.Errorf("reply %+v, want the value 5 from b", reply)
+	}
+	if _, err := messenger.Request(context.Background(), b.ID(), Message{Type: "other", From: "a"}); err == nil || err.Error() != "unsupported" {
+		t.Errorf("request of an unknown type returned %v, want the error of the handler", err)
+	}
+}
+
+func TestMessengerSend(t *testing.T) {
+	a, b := newTestHosts(t)
+	got := make(chan Message, 1)
+	NewMessenger(b, func(from peer.ID, msg Message) (Message, error) {
+		got <- msg
+		return Message{}, nil
+	})
+	messenger := NewMessenger(a, nil)
+	defer messenger.Close()
+
+	if err := messenger.Send(context.Background(), b.ID(), Message{Type: MsgValue, From: "a", Payload: []byte("7")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-got:
+		if msg.From != "a" || string(msg.Payload) != "7" {
+			t.Errorf("received %+v, want the value 7 from a", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the message was not delivered")
+	}
+}
+
+// A request gives up as soon as the context of the caller is done,
+// without waiting for streamTimeout
+func TestMessengerRequestCancelled(t *testing.T) {
+	a, b := newTestHosts(t)
+	release := make(chan struct{})
+	defer close(release)
+	NewMessenger(b, func(from peer.ID, msg Message) (Message, error) {
+		<-release
+		return Message{}, nil
+	})
+	messenger := NewMessenger(a, nil)
+	defer messenger.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := messenger.Request(ctx, b.ID(), Message{Type: MsgValue, From: "a"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("request returned %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("request took %v after its context was done", elapsed)
+	}
+}
+
+// Payloads as large as the facts of a game of keys fit in a frame
+// both ways, once base64 encoded
+func TestMessengerLargestPayload(t *testing.T) {
+	a, b := newTestHosts(t)
+	payload := bytes.Repeat([]byte{0xff}, reader.MaxFactsSize)
+	NewMessenger(b, func(from peer.ID, msg Message) (Message, error) {
+		if !bytes.Equal(msg.Payload, payload) {
+			return Message{}, errors.New("the payload of the request changed")
+		}
+		return Message{Type: MsgValue, From: "agent-with-a-long-name", Payload: payload}, nil
+	})
+	messenger := NewMessenger(a, nil)
+	defer messenger.Close()
+
+	reply, err := messenger.Request(context.Background(), b.ID(), Message{Type: MsgValue, From: "agent-with-a-long-name", Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply.Payload, payload) {
+		t.Errorf("reply of %d bytes, want the payload of %d bytes", len(reply.Payload), len(payload))
+	}
+}
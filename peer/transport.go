@@ -0,0 +1,35 @@
+package peer
+
+import (
+	"liarslie/reader"
+
+	"github.com/libp2p/go-libp2p"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+)
+
+// `transportOptions` enables every transport used by the fleet so
+// that a host can dial all of its peers, whatever they listen on
+func transportOptions(agents []reader.ParticipantSet) libp2p.Option {
+	used := make(map[string]bool)
+	for _, agent := range agents {
+		used[agent.GetTransport()] = true
+	}
+
+	var opts []libp2p.Option
+	if used[reader.TransportTCP] {
+		opts = append(opts, libp2p.Transport(tcp.NewTCPTransport))
+	}
+	if used[reader.TransportQUIC] {
+		opts = append(opts, libp2p.Transport(quic.NewTransport))
+	}
+	if used[reader.TransportWS] {
+		opts = append(opts, libp2p.Transport(ws.New))
+	}
+	if len(opts) == 0 {
+		return libp2p.DefaultTransports
+	}
+
+	return libp2p.ChainOptions(opts...)
+}
@@ -1,76 +0,0 @@
-package cmd
-
-import (
-	"fmt"
-	"os"
-
-	homedir "github.com/mitchellh/go-homedir"
-	"github.com/shirou/gopsutil/v3/process"
-	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-)
-
-var (
-	// This is used for config file
-	cfgFile string
-
-	rootCmd = &cobra.Command{
-		Use:   "liarslie",
-		Short: "liarslie: A sample CLI application",
-		Long:  `liarslie: A sample CLI application written in Go for find liars in a network`,
-	}
-)
-
-func Execute() error {
-	return rootCmd.Execute()
-}
-
-func init() {
-	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.liarslie.yaml)")
-}
-
-func er(msg interface{}) {
-	fmt.Println("Error:", msg)
-	os.Exit(1)
-}
-
-func initConfig() {
-
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		home, err := homedir.Dir()
-		if err != nil {
-			er(err)
-		}
-
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".liarslie")
-	}
-
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
-	}
-}
-
-// `KillProcess` kills a process by name `name`
-// Used for killing `liarslie`
-func KillProcess(name string) error {
-	processes, err := process.Processes()
-	if err != nil {
-		return err
-	}
-	for _, p := range processes {
-		n, err := p.Name()
-		if err != nil {
-			return err
-		}
-		if n == name {
-			return p.Kill()
-		}
-	}
-	return fmt.Errorf("process not found")
-}
@@ -1,20 +0,0 @@
-package cmd
-
-import (
-	"fmt"
-
-	"github.com/spf13/cobra"
-)
-
-func init() {
-	rootCmd.AddCommand(versionCmd)
-}
-
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print current version of liarslie",
-	Long:  `This command can be used get the version number of liarslie`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("liarslie v0.0.1")
-	},
-}
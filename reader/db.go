@@ -1,25 +1,116 @@
 package reader
 
 import (
+	"path/filepath"
 	"sync"
+)
 
-	"git.mills.io/prologic/bitcask"
+// keys held in the private vault of an agent
+const (
+	// ValueKey is the value the agent observed
+	ValueKey = "value"
+	// DecidedKey is the value the agent decided on after
+	// hearing from its peers
+	DecidedKey = "decided"
 )
 
 var lock = &sync.Mutex{}
-var db *bitcask.Bitcask
-
-// `GetInstance`models the vault(KV store) as a
-// Singleton.
-// The vault stores IP/truth-value mappings for liarslie
-func GetInstance() *bitcask.Bitcask {
-	if db == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if db == nil {
-			db, _ = bitcask.Open("storage/")
-			defer db.Close()
+var vaults = make(map[string]Vault)
+
+// `AgentStorageDir` is the directory of the private vault
+// of agent `agent` in game `game`
+func AgentStorageDir(game string, agent string) string {
+	return filepath.Join(StorageDir(game), agent)
+}
+
+// `GetAgentVault` models the private vault(KV store) of an agent
+// as a Singleton per agent, opened with the selected backend.
+// The vault only stores the agent's own observed value and protocol state.
+func GetAgentVault(game string, agent string) (Vault, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	dir := AgentStorageDir(game, agent)
+	if db, ok := vaults[dir]; ok {
+		return db, nil
+	}
+	db, err := OpenVault(dir)
+	if err != nil {
+		return nil, err
+	}
+	vaults[dir] = db
+	return db, nil
+}
+
+// `GetAgentValue` returns the value an agent currently stands by:
+// the decided value if it has decided, its observed value otherwise.
+func GetAgentValue(game string, agent string) (string, error) {
+	db, err := GetAgentVault(game, agent)
+	if err != nil {
+		return "", err
+	}
+	var value []byte
+	err = db.View(func(tx Tx) error {
+		if value, err = tx.Get([]byte(DecidedKey)); err == nil {
+			return nil
+		}
+		value, err = tx.Get([]byte(ValueKey))
+		return err
+	})
+	return string(value), err
+}
+
+// `KillAgent` removes the observed and decided value of an agent
+// from its vault. The agent then casts empty votes, which removes
+// it from the network.
+func KillAgent(game string, agent string) error {
+	db, err := GetAgentVault(game, agent)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx Tx) error {
+		if err := tx.Delete([]byte(ValueKey)); err != nil {
+			return err
+		}
+		return tx.Delete([]byte(DecidedKey))
+	})
+}
+
+// `ObserveValue` makes an agent observe `value` instead of the value
+// it observed so far. The value it decided on is dropped, so that it
+// takes part in the next round with what it observes now.
+func ObserveValue(game string, agent string, value string) error {
+	db, err := GetAgentVault(game, agent)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx Tx) error {
+		if err := tx.Put([]byte(ValueKey), []byte(value)); err != nil {
+			return err
 		}
+		return tx.Delete([]byte(DecidedKey))
+	})
+}
+
+// `CloseAgentVault` flushes and closes the vault of agent `agent`
+// of game `game`, if this process opened it
+func CloseAgentVault(game string, agent string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	dir := AgentStorageDir(game, agent)
+	db, ok := vaults[dir]
+	if !ok {
+		return nil
+	}
+	delete(vaults, dir)
+	return db.Close()
+}
+
+// `CloseVaults` closes every vault opened by this process
+func CloseVaults() {
+	lock.Lock()
+	defer lock.Unlock()
+	for dir, db := range vaults {
+		db.Close()
+		delete(vaults, dir)
 	}
-	return db
 }
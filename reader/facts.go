@@ -0,0 +1,293 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxKeys bounds the keys of a game
+	maxKeys = 64
+	// MaxFactsSize bounds the encoding of the facts of an agent,
+	// which travel in a single message. No value of a game is
+	// larger.
+	MaxFactsSize = 3 << 10
+)
+
+// Facts are the values an agent holds for the keys of a game of
+// keys, see ValueSpec.KEYS
+type Facts map[string]Value
+
+// `Value` encodes the facts as a JSON object with sorted keys. It is
+// the value agents of a game of keys observe, report and decide on,
+// so that every key travels in the same message.
+func (f Facts) Value() Value {
+	if len(f) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(map[string]Value(f))
+	return Value(data)
+}
+
+// KeySpec is a key of a game of keys: its true value and what its
+// liars observe instead. Liars observe LIE if set, otherwise each
+// draws a number of its own between LOW and HIGH, which default to
+// 0 and the max value of the game. Keys without HIGH need a max
+// value.
+type KeySpec struct {
+	KEY   string
+	VALUE Value
+	LIE   Value `json:",omitempty"`
+	LOW   Value `json:",omitempty"`
+	HIGH  Value `json:",omitempty"`
+}
+
+// `ParseKeySpec` parses a key given on the command line:
+//
+//	NAME=VALUE            liars draw a number between 0 and the max value
+//	NAME=VALUE@LIE        liars observe LIE
+//	NAME=VALUE@LOW..HIGH  liars draw a number between LOW and HIGH
+//
+// Values holding `@` need a lie, or a keys file.
+func ParseKeySpec(spec string) (KeySpec, error) {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return KeySpec{}, fmt.Errorf("key %q: expected NAME=VALUE[@LIE]", spec)
+	}
+	key := KeySpec{KEY: name, VALUE: Value(value)}
+	if at := strings.LastIndex(value, "@"); at >= 0 {
+		key.VALUE = Value(value[:at])
+		lie := value[at+1:]
+		if low, high, isRange := strings.Cut(lie, ".."); isRange {
+			key.LOW, key.HIGH = Value(low), Value(high)
+		} else {
+			key.LIE = Value(lie)
+		}
+	}
+	return key, nil
+}
+
+// `ReadKeysFile` reads the keys of a game from `file`, a JSON list
+// of KeySpec
+func ReadKeysFile(file string) ([]KeySpec, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var keys []KeySpec
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", file)
+	}
+	return keys, nil
+}
+
+// `Validate` puts the values of the key in the canonical encoding of
+// `t`, fills in the range of the liars up to `maxValue` and checks
+// that they have something to lie with. A `maxValue` below 1 is no
+// max value.
+func (k *KeySpec) Validate(t ValueType, maxValue int) error {
+	if err := validKey(k.KEY); err != nil {
+		return err
+	}
+	var err error
+	if k.VALUE, err = t.Canonical(string(k.VALUE)); err != nil {
+		return fmt.Errorf("key %s: true value: %w", k.KEY, err)
+	}
+	if k.LIE != "" {
+		if k.LIE, err = t.Canonical(string(k.LIE)); err != nil {
+			return fmt.Errorf("key %s: liar value: %w", k.KEY, err)
+		}
+		k.LOW, k.HIGH = "", ""
+		return nil
+	}
+	if !t.Numeric() {
+		return fmt.Errorf("key %s: liars of a game of %s values need a value to lie with", k.KEY, t)
+	}
+	if k.LOW == "" {
+		k.LOW = "0"
+	}
+	if k.HIGH == "" {
+		if maxValue < 1 {
+			return fmt.Errorf("key %s: liars need a max value to draw up to, or a range %s=%s@LOW..HIGH", k.KEY, k.KEY, k.VALUE)
+		}
+		k.HIGH = IntValue(maxValue)
+	}
+	if k.LOW, err = t.Canonical(string(k.LOW)); err != nil {
+		return fmt.Errorf("key %s: lowest liar value: %w", k.KEY, err)
+	}
+	if k.HIGH, err = t.Canonical(string(k.HIGH)); err != nil {
+		return fmt.Errorf("key %s: highest liar value: %w", k.KEY, err)
+	}
+	low, high := numberOf(k.LOW), numberOf(k.HIGH)
+	if low > high {
+		return fmt.Errorf("key %s: liar values %s..%s are an empty range", k.KEY, k.LOW, k.HIGH)
+	}
+	if t == TypeInt && low == high && k.LOW == k.VALUE {
+		return fmt.Errorf("key %s: liar values %s..%s leave no false value", k.KEY, k.LOW, k.HIGH)
+	}
+	return nil
+}
+
+// `lie` is the value a liar observes for a valid key of type `t`.
+// Int liars never draw the true value.
+func (k KeySpec) lie(t ValueType) Value {
+	if k.LIE != "" {
+		return k.LIE
+	}
+	if t == TypeFloat {
+		low, high := numberOf(k.LOW), numberOf(k.HIGH)
+		return floatValue(low + RandomFloat64()*(high-low))
+	}
+	low, high, truth := int(numberOf(k.LOW)), int(numberOf(k.HIGH)), int(numberOf(k.VALUE))
+	if truth < low || truth > high {
+		return IntValue(low + RandomIntn(high-low+1))
+	}
+	// any value of the range except the true one
+	value := low + RandomIntn(high-low)
+	if value >= truth {
+		value++
+	}
+	return IntValue(value)
+}
+
+// `numberOf` is the number of canonical numeric value `v`
+func numberOf(v Value) float64 {
+	n, _ := strconv.ParseFloat(string(v), 64)
+	return n
+}
+
+// `KeyNames` are the names of `keys`
+func KeyNames(keys []KeySpec) []string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.KEY
+	}
+	return names
+}
+
+// `validKey` checks the name of a key
+func validKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key without a name")
+	}
+	if strings.ContainsAny(key, "=@\" \t\n") {
+		return fmt.Errorf("key %q: names cannot hold '=', '@', quotes or whitespace", key)
+	}
+	return nil
+}
+
+// `validateKeys` checks the key names of a spec
+func validateKeys(keys []string) error {
+	if len(keys) > maxKeys {
+		return fmt.Errorf("more than %d keys", maxKeys)
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if err := validKey(key); err != nil {
+			return err
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate key %s", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// `Facts` parses the facts of value `v` of a game of keys, putting
+// each in the canonical encoding of the type of the spec. Keys the
+// game does not have are an error; missing keys are not.
+func (s ValueSpec) Facts(v Value) (Facts, error) {
+	var facts Facts
+	if err := json.Unmarshal([]byte(v), &facts); err != nil || facts == nil {
+		return nil, fmt.Errorf("%q is not a JSON object of keys", v)
+	}
+	known := make(map[string]bool)
+	for _, key := range s.KEYS {
+		known[key] = true
+	}
+	for key, value := range facts {
+		if !known[key] {
+			return nil, fmt.Errorf("unknown key %s", key)
+		}
+		canonical, err := s.TYPE.Canonical(string(value))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		facts[key] = canonical
+	}
+	return facts, nil
+}
+
+// `Canonical` parses `v` as a value of the game: a value of the type
+// of the spec, or for a game of keys the facts of every key
+func (s ValueSpec) Canonical(v string) (Value, error) {
+	if len(s.KEYS) == 0 {
+		return s.TYPE.Canonical(v)
+	}
+	facts, err := s.Facts(Value(v))
+	if err != nil {
+		return "", err
+	}
+	for _, key := range s.KEYS {
+		if _, ok := facts[key]; !ok {
+			return "", fmt.Errorf("no value for key %s", key)
+		}
+	}
+	value := facts.Value()
+	if len(value) > MaxFactsSize {
+		return "", fmt.Errorf("the values of the keys take more than %d bytes", MaxFactsSize)
+	}
+	return value, nil
+}
+
+// `decideFacts` decides every key on its own, from the facts of the
+// votes that are valid, with the aggregation of the spec. Keys no
+// value can be decided for are left out.
+func (s ValueSpec) decideFacts(votes []Value) Value {
+	single := ValueSpec{TYPE: s.TYPE, AGGREGATION: s.AGGREGATION}
+	byKey := make(map[string][]Value)
+	for _, vote := range votes {
+		facts, err := s.Facts(vote)
+		if err != nil {
+			continue
+		}
+		for key, value := range facts {
+			byKey[key] = append(byKey[key], value)
+		}
+	}
+	decided := make(Facts)
+	for _, key := range s.KEYS {
+		if value := single.Decide(byKey[key]); value != "" {
+			decided[key] = value
+		}
+	}
+	return decided.Value()
+}
+
+// `AddKeyAgentsToConfig` is `AddAgentsToConfig` for a game of keys:
+// truth speakers observe the true value of every key of `keys` and
+// liars a lie for every key, see KeySpec. The keys must be valid
+// for values of type `t`.
+func AddKeyAgentsToConfig(numAgents int, keys []KeySpec, t ValueType, ratio float64, transport string, role string, ports PortRange, config string) error {
+	truth := make(Facts)
+	for _, key := range keys {
+		truth[key.KEY] = key.VALUE
+	}
+	_, err := AddAgents(config, truth.Value(), numAgents, transport, role, ports, ratioModel(numAgents, ratio, truth.Value(), func() Value {
+		lies := make(Facts)
+		// draw in the order the keys are given, so that runs with
+		// the same seed tell the same lies
+		for _, key := range keys {
+			lies[key.KEY] = key.lie(t)
+		}
+		return lies.Value()
+	}))
+	return err
+}
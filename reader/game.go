@@ -0,0 +1,243 @@
+package reader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConfig is the agents config used when none is given
+const DefaultConfig = "agents.json"
+
+// registryFile lists every game started on this machine
+const registryFile = "games.json"
+
+// registryLock is locked by the processes updating the registry,
+// and registryMu by the goroutines of this process doing so
+const registryLock = registryFile + ".lock"
+
+var registryMu sync.Mutex
+
+// storageRoot is the directory holding the vaults of all games
+const storageRoot = "storage/"
+
+// runRoot is the directory holding the control sockets of the
+// agents running as daemons
+const runRoot = "run/"
+
+// GameConfig is the content of an agents config. Each
+// game is identified by a GAMEID generated at `start`.
+// VERSION is the schema version, see `ParseGameConfig`.
+type GameConfig struct {
+	VERSION   int
+	GAMEID    string
+	CREATEDAT time.Time
+	// VALUES describes the values agents agree on, games without
+	// it play with DefaultValueSpec
+	VALUES *ValueSpec `json:",omitempty"`
+	AGENTS []ParticipantSet
+}
+
+// `ValueSpec` is the value spec of the game, with its defaults
+// filled in. Specs that do not validate are an error.
+func (g GameConfig) ValueSpec() (ValueSpec, error) {
+	if g.VALUES == nil {
+		return DefaultValueSpec, nil
+	}
+	spec := *g.VALUES
+	if err := spec.Validate(); err != nil {
+		return spec, fmt.Errorf("game %s: %w", g.GAMEID, err)
+	}
+	return spec, nil
+}
+
+// GameEntry describes a game in the registry
+type GameEntry struct {
+	GAMEID  string
+	CONFIG  string
+	CREATED time.Time
+}
+
+// gameIDSize is the number of random bytes of a game identifier
+const gameIDSize = 4
+
+// `NewGameID` generates a random game identifier
+func NewGameID() (string, error) {
+	buf := make([]byte, gameIDSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// `ValidGameID` checks that `id` has the form of the identifiers of
+// NewGameID. Game IDs name directories, so IDs read from untrusted
+// input must be checked before they touch the disk.
+func ValidGameID(id string) error {
+	if len(id) != 2*gameIDSize || strings.ToLower(id) != id {
+		return fmt.Errorf("invalid game ID %q", id)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return fmt.Errorf("invalid game ID %q", id)
+	}
+	return nil
+}
+
+// `ReadGameConfig` reads a game config. Configs written by older
+// versions are migrated and written back in the current format.
+func ReadGameConfig(config string) (GameConfig, error) {
+	file, err := ioutil.ReadFile(config)
+	if err != nil {
+		return GameConfig{}, err
+	}
+	game, migrated, err := ParseGameConfig(file)
+	if err != nil {
+		return game, fmt.Errorf("%s: %w", config, err)
+	}
+	if migrated {
+		err = WriteGameConfig(config, game)
+	}
+	return game, err
+}
+
+// `WriteGameConfig` writes a game config to disk, one field per
+// line so that validation errors point at the offending agent
+func WriteGameConfig(config string, game GameConfig) error {
+	game.VERSION = ConfigVersion
+	dataBytes, err := json.MarshalIndent(game, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config, dataBytes, 0644)
+}
+
+// `SetValueSpec` records the value spec of the game played with
+// `config`. The default spec is left out of the config.
+func SetValueSpec(config string, spec ValueSpec) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	game, err := ReadGameConfig(config)
+	if err != nil {
+		return err
+	}
+	game.VALUES = &spec
+	if spec.IsDefault() {
+		game.VALUES = nil
+	}
+	return WriteGameConfig(config, game)
+}
+
+// `GetGameID` returns the game ID stored in a config
+func GetGameID(config string) string {
+	game, _ := ReadGameConfig(config)
+	return game.GAMEID
+}
+
+// `StorageDir` is the vault directory of game `game`
+func StorageDir(game string) string {
+	return filepath.Join(storageRoot, game)
+}
+
+// `RunDir` is the directory of the running agents of game `game`
+func RunDir(game string) string {
+	return filepath.Join(runRoot, game)
+}
+
+// `GameKeystoreDir` is the keystore directory of game `game`
+func GameKeystoreDir(game string) string {
+	return filepath.Join(KeystoreDir, game)
+}
+
+// `RemoveGameArtifacts` removes the vault, keys and run directory
+// of game `game`
+func RemoveGameArtifacts(game string) {
+	os.RemoveAll(StorageDir(game))
+	os.RemoveAll(GameKeystoreDir(game))
+	os.RemoveAll(RunDir(game))
+}
+
+// `ListGames` returns the games in the registry
+func ListGames() ([]GameEntry, error) {
+	var games []GameEntry
+	file, err := ioutil.ReadFile(registryFile)
+	if os.IsNotExist(err) {
+		return games, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(file, &games)
+	return games, err
+}
+
+// `FindGame` looks up game `game` in the registry
+func FindGame(game string) (GameEntry, bool) {
+	games, _ := ListGames()
+	for _, entry := range games {
+		if entry.GAMEID == game {
+			return entry, true
+		}
+	}
+	return GameEntry{}, false
+}
+
+// `RegisterGame` adds a game to the registry
+func RegisterGame(entry GameEntry) error {
+	return updateRegistry(func(games []GameEntry) []GameEntry {
+		return append(games, entry)
+	})
+}
+
+// `UnregisterGame` removes game `game` from the registry
+func UnregisterGame(game string) error {
+	return updateRegistry(func(games []GameEntry) []GameEntry {
+		kept := games[:0]
+		for _, entry := range games {
+			if entry.GAMEID != game {
+				kept = append(kept, entry)
+			}
+		}
+		return kept
+	})
+}
+
+// `updateRegistry` replaces the games of the registry by what
+// `update` makes of them. Concurrent updates, also by other
+// processes, wait for each other, so that none is lost.
+func updateRegistry(update func(games []GameEntry) []GameEntry) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	unlock, err := lockFile(registryLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	games, err := ListGames()
+	if err != nil {
+		return err
+	}
+	return writeRegistry(update(games))
+}
+
+// `writeRegistry` writes the registry to disk. It is replaced in one
+// step, so readers never see a partly written registry.
+func writeRegistry(games []GameEntry) error {
+	dataBytes, err := json.Marshal(games)
+	if err != nil {
+		return err
+	}
+	temp := registryFile + ".tmp"
+	if err := ioutil.WriteFile(temp, dataBytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, registryFile)
+}
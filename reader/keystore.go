@@ -0,0 +1,54 @@
+package reader
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// KeystoreDir is the directory holding one private key per agent
+const KeystoreDir = "keystore/"
+
+// `GenerateIdentity` creates a new Ed25519 identity for agent `user`,
+// stores it in the keystore directory `dir` and returns its peer ID.
+func GenerateIdentity(dir string, user string) (peer.ID, error) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(keyPath(dir, user), data, 0600); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// `LoadIdentity` reads the private key of agent `user` from
+// the keystore directory `dir`.
+func LoadIdentity(dir string, user string) (crypto.PrivKey, error) {
+	data, err := ioutil.ReadFile(keyPath(dir, user))
+	if err != nil {
+		return nil, err
+	}
+	return crypto.UnmarshalPrivateKey(data)
+}
+
+// `keyPath` is the location of the key of agent `user`
+func keyPath(dir string, user string) string {
+	return filepath.Join(dir, user+".key")
+}
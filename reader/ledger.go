@@ -0,0 +1,166 @@
+package reader
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ledgerRoot is the directory holding the history of all games.
+// Unlike storage it survives `stop`.
+const ledgerRoot = "ledger/"
+
+// AgentRecord is what a single agent did during a round
+type AgentRecord struct {
+	USER     string
+	LIAR     bool
+	REPORTED string
+	RECEIVED int
+	DECIDED  string
+	DURATION time.Duration
+}
+
+// RoundRecord is an entry of the ledger. Each record carries the
+// hash of the previous one, so rewriting history breaks the chain.
+type RoundRecord struct {
+	GAME     string
+	ROUND    int
+	MODE     string
+	TRUTH    Value
+	AGENTS   []AgentRecord
+	STARTED  time.Time
+	DURATION time.Duration
+	// SEED is left out of records written before runs were seeded,
+	// so that their hashes still verify
+	SEED int64 `json:",omitempty"`
+	// VALUES and DECIDED, the value the network decided on, are
+	// left out of records written before values were typed. The
+	// network of such records decided on the highest int value.
+	VALUES   *ValueSpec `json:",omitempty"`
+	DECIDED  Value      `json:",omitempty"`
+	PREVHASH string
+	HASH     string
+}
+
+// `ledgerPath` is the ledger file of game `game`
+func ledgerPath(game string) string {
+	return filepath.Join(ledgerRoot, game+".jsonl")
+}
+
+// `hashRecord` hashes a record with its HASH field left empty
+func hashRecord(record RoundRecord) (string, error) {
+	record.HASH = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// `AppendRound` appends a record to the ledger of its game. The
+// round number and hashes are filled in from the existing ledger.
+func AppendRound(record *RoundRecord) error {
+	records, err := ReadLedger(record.GAME)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	record.ROUND = 1
+	record.PREVHASH = ""
+	if n := len(records); n > 0 {
+		record.ROUND = records[n-1].ROUND + 1
+		record.PREVHASH = records[n-1].HASH
+	}
+	if record.HASH, err = hashRecord(*record); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ledgerRoot, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(ledgerPath(record.GAME), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// `ReadLedger` reads every record of the ledger of game `game`
+func ReadLedger(game string) ([]RoundRecord, error) {
+	file, err := os.Open(ledgerPath(game))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseLedger(file)
+}
+
+// `parseLedger` reads the records of a ledger, one per line
+func parseLedger(r io.Reader) ([]RoundRecord, error) {
+	var records []RoundRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record RoundRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// `VerifyLedger` checks the hash chain of a ledger and reports
+// the first record that was tampered with
+func VerifyLedger(records []RoundRecord) error {
+	previous := ""
+	for _, record := range records {
+		if record.PREVHASH != previous {
+			return fmt.Errorf("round %d does not follow the previous round", record.ROUND)
+		}
+		hash, err := hashRecord(record)
+		if err != nil {
+			return err
+		}
+		if hash != record.HASH {
+			return fmt.Errorf("round %d has been tampered with", record.ROUND)
+		}
+		previous = record.HASH
+	}
+	return nil
+}
+
+// `ListLedgers` returns the IDs of all games with a ledger
+func ListLedgers() ([]string, error) {
+	files, err := ioutil.ReadDir(ledgerRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var games []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".jsonl") {
+			games = append(games, strings.TrimSuffix(file.Name(), ".jsonl"))
+		}
+	}
+	sort.Strings(games)
+	return games, nil
+}
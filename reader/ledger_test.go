@@ -0,0 +1,92 @@
+package reader
+
+import (
+	"testing"
+)
+
+// `appendTestRounds` appends `n` rounds to the ledger of game `game`
+// and reads them back
+func appendTestRounds(t *testing.T, game string, n int) []RoundRecord {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		record := RoundRecord{
+			GAME:    game,
+			MODE:    RoleStandard,
+			TRUTH:   IntValue(5 + i),
+			AGENTS:  []AgentRecord{{USER: "a", REPORTED: "5", DECIDED: "5"}, {USER: "b", LIAR: true, REPORTED: "9", DECIDED: "5"}},
+			DECIDED: "5",
+		}
+		if err := AppendRound(&record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := ReadLedger(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestAppendRoundChainsRecords(t *testing.T) {
+	inTempDir(t)
+	records := appendTestRounds(t, "1ed6e001", 3)
+	if len(records) != 3 {
+		t.Fatalf("the ledger has %d records, want 3", len(records))
+	}
+	for i, record := range records {
+		if record.ROUND != i+1 {
+			t.Errorf("record %d is round %d", i+1, record.ROUND)
+		}
+		if i > 0 && record.PREVHASH != records[i-1].HASH {
+			t.Errorf("round %d does not carry the hash of round %d", i+1, i)
+		}
+	}
+	if records[0].PREVHASH != "" {
+		t.Errorf("the first round follows %q", records[0].PREVHASH)
+	}
+	if err := VerifyLedger(records); err != nil {
+		t.Errorf("an untouched ledger does not verify: %v", err)
+	}
+}
+
+func TestVerifyLedgerDetectsTampering(t *testing.T) {
+	inTempDir(t)
+	records := appendTestRounds(t, "1ed6e002", 3)
+
+	for name, tamper := range map[string]func([]RoundRecord) []RoundRecord{
+		"edited truth": func(r []RoundRecord) []RoundRecord {
+			r[1].TRUTH = "9"
+			return r
+		},
+		"edited agent": func(r []RoundRecord) []RoundRecord {
+			r[0].AGENTS[1].LIAR = false
+			return r
+		},
+		"edited decision": func(r []RoundRecord) []RoundRecord {
+			r[2].DECIDED = "9"
+			return r
+		},
+		"reordered": func(r []RoundRecord) []RoundRecord {
+			return []RoundRecord{r[1], r[0], r[2]}
+		},
+		"first round dropped": func(r []RoundRecord) []RoundRecord {
+			return r[1:]
+		},
+		"middle round dropped": func(r []RoundRecord) []RoundRecord {
+			return []RoundRecord{r[0], r[2]}
+		},
+	} {
+		// tamper with a copy, agents included
+		tampered := make([]RoundRecord, len(records))
+		for i, record := range records {
+			record.AGENTS = append([]AgentRecord(nil), record.AGENTS...)
+			tampered[i] = record
+		}
+		if err := VerifyLedger(tamper(tampered)); err == nil {
+			t.Errorf("%s: the ledger verifies", name)
+		}
+	}
+	if err := VerifyLedger(records); err != nil {
+		t.Errorf("tampering with copies changed the ledger: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package reader
+
+import (
+	"os"
+	"syscall"
+)
+
+// `lockFile` takes an exclusive lock on `file`, creating it, and
+// waits until other processes holding it are done
+func lockFile(file string) (unlock func(), err error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
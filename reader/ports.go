@@ -0,0 +1,107 @@
+package reader
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PortRange is an inclusive range of ports agents may listen on
+type PortRange struct {
+	MIN int
+	MAX int
+}
+
+// DefaultPortRange is used when no `--port-range` is given
+var DefaultPortRange = PortRange{MIN: 10000, MAX: 65535}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.MIN, r.MAX)
+}
+
+// `ParsePortRange` parses a range written as "min-max".
+// An empty string selects DefaultPortRange.
+func ParsePortRange(s string) (PortRange, error) {
+	if s == "" {
+		return DefaultPortRange, nil
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return PortRange{}, fmt.Errorf("port range %q is not of the form min-max", s)
+	}
+	min, minErr := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	max, maxErr := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if minErr != nil || maxErr != nil {
+		return PortRange{}, fmt.Errorf("port range %q is not of the form min-max", s)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("port range %q is empty or outside 1-65535", s)
+	}
+	return PortRange{MIN: min, MAX: max}, nil
+}
+
+// PortAllocator hands out ports that are neither taken by agents
+// already in the config nor bound by any other process
+type PortAllocator struct {
+	rng  PortRange
+	next int
+	used map[string]bool
+}
+
+// `NewPortAllocator` creates an allocator for `rng` that skips the
+// ports of `agents`. Allocation starts at a random port in the range
+// so that games started side by side rarely probe the same ports.
+func NewPortAllocator(rng PortRange, agents []ParticipantSet) (*PortAllocator, error) {
+	a := &PortAllocator{rng: rng, next: rng.MIN + RandomIntn(rng.MAX-rng.MIN+1), used: make(map[string]bool)}
+	for _, agent := range agents {
+		if addr, err := ma.NewMultiaddr(agent.IP); err == nil {
+			a.used[socketOf(addr)] = true
+		}
+	}
+	return a, nil
+}
+
+// `Allocate` returns a free port for an agent listening on `transport`
+func (a *PortAllocator) Allocate(transport string) (int, error) {
+	network := "tcp"
+	if transport == TransportQUIC {
+		network = "udp"
+	}
+	size := a.rng.MAX - a.rng.MIN + 1
+	for tries := 0; tries < size; tries++ {
+		port := a.next
+		a.next++
+		if a.next > a.rng.MAX {
+			a.next = a.rng.MIN
+		}
+		socket := network + "/" + strconv.Itoa(port)
+		if a.used[socket] || !portFree(network, port) {
+			continue
+		}
+		a.used[socket] = true
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free %s port left in range %s", network, a.rng)
+}
+
+// `portFree` probes whether `port` can be bound on all interfaces
+func portFree(network string, port int) bool {
+	addr := ":" + strconv.Itoa(port)
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
@@ -0,0 +1,53 @@
+package reader
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rng drives every random choice made while setting up a game:
+// ports, names, liar assignment and liar values. Runs with the
+// same seed make the same choices. Game IDs and agent keys are
+// not derived from it, they stay cryptographically random.
+var (
+	rngLock = &sync.Mutex{}
+	seed    = time.Now().UnixNano()
+	rng     = rand.New(rand.NewSource(seed))
+)
+
+// `SetSeed` seeds the random choices of this run
+func SetSeed(s int64) {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+	seed = s
+	rng = rand.New(rand.NewSource(s))
+}
+
+// `Seed` returns the seed of this run
+func Seed() int64 {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+	return seed
+}
+
+// `RandomIntn` returns a seeded random number in [0, n)
+func RandomIntn(n int) int {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+	return rng.Intn(n)
+}
+
+// `RandomFloat64` returns a seeded random number in [0, 1)
+func RandomFloat64() float64 {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+	return rng.Float64()
+}
+
+// `RandomPerm` returns a seeded random permutation of [0, n)
+func RandomPerm(n int) []int {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+	return rng.Perm(n)
+}
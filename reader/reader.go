@@ -1,14 +1,9 @@
 package reader
 
 import (
-	"crypto/rand"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"math"
-	"math/big"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/goombaio/namegenerator"
 )
@@ -16,70 +11,154 @@ import (
 // ParticipantSet defines the identity of
 // an agent in a network
 type ParticipantSet struct {
-	USER string
-	IP   string
+	USER      string
+	IP        string
+	PEERID    string
+	TRANSPORT string
+	ROLE      string
 }
 
+// ValueModel decides the value observed by the i-th agent added
+// and whether that agent is a liar
+type ValueModel func(i int) (value Value, liar bool)
+
 // `AddAgentsToConfig` appends new agents to a
 // config file. If the file does not exist, a blank
-// file is created.
-func AddAgentsToConfig(numAgents int, value int, max_value int, ratio float64, config string) error {
-	err := checkFile(config)
-	data := []ParticipantSet{}
+// file is created together with a new game.
+// Truth speakers observe `value` and liars `lie`, both in the
+// canonical encoding of the values of the game.
+// Agents listen on `transport`, see `ListenAddress`, on free ports
+// of `ports`, and are recorded with `role`.
+func AddAgentsToConfig(numAgents int, value Value, lie Value, ratio float64, transport string, role string, ports PortRange, config string) error {
+	_, err := AddAgents(config, value, numAgents, transport, role, ports, ratioModel(numAgents, ratio, value, func() Value {
+		return lie
+	}))
+	return err
+}
 
-	if err != nil {
-		return err
+// `ratioModel` makes `ratio` of `numAgents` agents liars, which
+// observe what `lie` returns, and the rest truth speakers, which
+// observe `value`
+func ratioModel(numAgents int, ratio float64, value Value, lie func() Value) ValueModel {
+	// rounded, since ratios are parsed with the precision of a
+	// float32 and 0.2 of 10 agents must stay 2 liars
+	numLiars := int(math.Round(float64(numAgents) * ratio))
+	// the seeded permutation decides which agents lie, not how many
+	order := RandomPerm(numAgents)
+	return func(i int) (Value, bool) {
+		if order[i] >= numLiars {
+			// assign value v to truth speakers
+			return value, false
+		}
+		// assign false value to the liars
+		return lie(), true
 	}
-	db := GetInstance()
+}
 
-	file, err := ioutil.ReadFile(config)
+// `AddAgents` appends `numAgents` agents to a config, creating the
+// config and a new game if needed. `observe` assigns the value each
+// agent observes; liars are recorded in the ground truth, whose true
+// value becomes `value`. It returns the agents added.
+func AddAgents(config string, value Value, numAgents int, transport string, role string, ports PortRange, observe ValueModel) ([]ParticipantSet, error) {
+	err := checkFile(config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	json.Unmarshal(file, &data)
-	numTruthSpeakers := int(float64(numAgents) * (1 - ratio))
-	port, _ := pickRandomNumber(5)
+	game, err := ReadGameConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if game.GAMEID == "" && len(game.AGENTS) == 0 {
+		if game.GAMEID, err = NewGameID(); err != nil {
+			return nil, err
+		}
+		game.CREATEDAT = time.Now()
+		err = RegisterGame(GameEntry{GAMEID: game.GAMEID, CONFIG: config, CREATED: game.CREATEDAT})
+		if err != nil {
+			return nil, err
+		}
+	}
+	data := game.AGENTS
+	if err := os.MkdirAll(StorageDir(game.GAMEID), 0755); err != nil {
+		return nil, err
+	}
+	truth, _ := ReadGroundTruth(game.GAMEID)
+	truth.VALUE = value
 
-	numKeys := db.Len()
-	startIdx := 0
-	endIdx := numAgents
-	if numKeys > 0 {
-		startIdx = numKeys + 1
-		endIdx = numKeys + numAgents
+	allocator, err := NewPortAllocator(ports, data)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, agent := range data {
+		names[agent.USER] = true
 	}
 
-	// append data to struct and distribute true and false data to vault
-	for i := startIdx; i < endIdx; i++ {
-		nameGenerator := namegenerator.NewNameGenerator(int64(i))
-		name := nameGenerator.Generate()
+	// append data to struct and distribute true and false data to the agent vaults
+	startIdx := len(data)
+	for i := startIdx; i < startIdx+numAgents; i++ {
+		name := uniqueName(Seed()+int64(i), names)
+		// every agent keeps the same identity for the whole game
+		id, err := GenerateIdentity(GameKeystoreDir(game.GAMEID), name)
+		if err != nil {
+			return nil, err
+		}
+		agentTransport := AgentTransport(transport, i)
+		port, err := allocator.Allocate(agentTransport)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := ListenAddress(agentTransport, port)
+		if err != nil {
+			return nil, err
+		}
 		newStruct := &ParticipantSet{
-			USER: name,
-			IP:   fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
+			USER:      name,
+			IP:        addr,
+			PEERID:    id.Pretty(),
+			TRANSPORT: agentTransport,
+			ROLE:      role,
 		}
 
-		if i <= numTruthSpeakers {
-			// assign value v to truth speakers
-			db.Put([]byte(newStruct.IP), []byte(strconv.Itoa(value)))
-		} else {
-			// assign false value to the rest of the agents
-			db.Put([]byte(newStruct.IP), []byte(strconv.Itoa(int(float64(max_value)*ratio))))
+		db, err := GetAgentVault(game.GAMEID, name)
+		if err != nil {
+			return nil, err
+		}
+		observed, liar := observe(i - startIdx)
+		if err := db.Put([]byte(ValueKey), []byte(observed)); err != nil {
+			return nil, err
+		}
+		if liar {
+			truth.LIARS = append(truth.LIARS, name)
+			if truth.LIES == nil {
+				truth.LIES = make(map[string]Value)
+			}
+			truth.LIES[name] = observed
 		}
 
 		data = append(data, *newStruct)
-		port = port + 1
 	}
 
-	dataBytes, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(config, dataBytes, 0644)
-	if err != nil {
-		return err
+	if err := WriteGroundTruth(game.GAMEID, truth); err != nil {
+		return nil, err
 	}
+	game.AGENTS = data
+	return data[startIdx:], WriteGameConfig(config, game)
+}
 
-	return nil
+// `uniqueName` generates a name from `seed` that is not in
+// `names` yet, and adds it to `names`. Names from
+// different seeds may collide, so the seed is advanced until a
+// free name is found.
+func uniqueName(seed int64, names map[string]bool) string {
+	for ; ; seed += 1 << 32 {
+		name := namegenerator.NewNameGenerator(seed).Generate()
+		if !names[name] {
+			names[name] = true
+			return name
+		}
+	}
 }
 
 // `checkFile` checks and creates config if not
@@ -95,43 +174,15 @@ func checkFile(filename string) error {
 	return nil
 }
 
-// `pickRandomNumber` generates random integer of n digits.
-func pickRandomNumber(denomination int) (int, error) {
-	maxLimit := int64(65536)
-	lowLimit := int(math.Pow10(5 - 1))
-	randomNumber, err := rand.Int(rand.Reader, big.NewInt(maxLimit))
-	if err != nil {
-		return 0, err
-	}
-	randomNumberInt := int(randomNumber.Int64())
-
-	if randomNumberInt <= lowLimit {
-		randomNumberInt += lowLimit
-	}
-	if randomNumberInt > int(maxLimit) {
-		randomNumberInt = int(maxLimit)
-	}
-
-	return randomNumberInt, nil
-}
-
 // `GetCurrentParticipants` gets participants from config.
-func GetCurrentParticipants(config string) []ParticipantSet {
-	var agents []ParticipantSet
-	file, err := ioutil.ReadFile(config)
-	if err != nil {
-		return agents
-	}
-	json.Unmarshal(file, &agents)
-
-	return agents
+func GetCurrentParticipants(config string) ([]ParticipantSet, error) {
+	game, err := ReadGameConfig(config)
+	return game.AGENTS, err
 }
 
 // `GetParticpantIP` gets IP of a certain participant from config.
 func GetParticpantIP(config string, id string) string {
-	var agents []ParticipantSet
-	file, _ := ioutil.ReadFile(config)
-	json.Unmarshal(file, &agents)
+	agents, _ := GetCurrentParticipants(config)
 
 	for i := 0; i < len(agents); i++ {
 		if agents[i].USER == id {
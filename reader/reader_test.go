@@ -0,0 +1,192 @@
+package reader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// `inTempDir` runs the test in a temporary working directory, which
+// holds the storage, ledgers and registry of its games
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestRatioModelLiarCount(t *testing.T) {
+	for _, test := range []struct {
+		numAgents int
+		ratio     string
+		liars     int
+	}{
+		{10, "0.2", 2},
+		{10, "0.3", 3},
+		{10, "0", 0},
+		{10, "1", 10},
+		{5, "0.5", 3},
+		{7, "0.1", 1},
+		{100, "0.33", 33},
+	} {
+		// ratios come from the command line with float32 precision
+		ratio, err := strconv.ParseFloat(test.ratio, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(0); seed < 20; seed++ {
+			SetSeed(seed)
+			model := ratioModel(test.numAgents, ratio, "5", func() Value { return "7" })
+			liars := 0
+			for i := 0; i < test.numAgents; i++ {
+				value, liar := model(i)
+				if liar != (value == "7") {
+					t.Fatalf("agent %d observes %s, liar %t", i, value, liar)
+				}
+				if liar {
+					liars++
+				}
+			}
+			if liars != test.liars {
+				t.Errorf("%d agents at %s with seed %d: %d liars, want %d", test.numAgents, test.ratio, seed, liars, test.liars)
+			}
+		}
+	}
+}
+
+func TestDecideLargeInts(t *testing.T) {
+	// 2^53 + 1 is the first int a float64 cannot hold
+	const big = "9007199254740993"
+	for _, test := range []struct {
+		aggregation Aggregation
+		votes       []Value
+		decided     Value
+	}{
+		{AggregateMedian, []Value{big, big, "1"}, big},
+		{AggregateMedian, []Value{"9223372036854775807", "9223372036854775806", "0"}, "9223372036854775806"},
+		{AggregateTrimmedMean, []Value{big, big, big}, big},
+		{AggregateTrimmedMean, []Value{"9223372036854775807", "9223372036854775807"}, "9223372036854775807"},
+		{AggregateTrimmedMean, []Value{"-9223372036854775808", "-9223372036854775807"}, "-9223372036854775808"},
+		{AggregateTrimmedMean, []Value{"1", "2"}, "2"},
+		{AggregateTrimmedMean, []Value{"-1", "-2"}, "-2"},
+		{AggregateTrimmedMean, []Value{"1", "2", "2"}, "2"},
+		{AggregateTrimmedMean, []Value{"0", "10", "11", "12", "1000"}, "11"},
+	} {
+		spec := ValueSpec{TYPE: TypeInt, AGGREGATION: test.aggregation}
+		if decided := spec.Decide(test.votes); decided != test.decided {
+			t.Errorf("%s of %v: decided %s, want %s", test.aggregation, test.votes, decided, test.decided)
+		}
+	}
+}
+
+func TestGameConfigInvalidValueSpec(t *testing.T) {
+	game := GameConfig{GAMEID: "0badc0de", VALUES: &ValueSpec{TYPE: TypeString, AGGREGATION: AggregateMedian}}
+	if _, err := game.ValueSpec(); err == nil {
+		t.Fatal("a game of strings decided by median has a value spec")
+	}
+	game.VALUES = &ValueSpec{TYPE: TypeFloat}
+	spec, err := game.ValueSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.AGGREGATION != AggregateMedian {
+		t.Errorf("default aggregation of floats is %s, want %s", spec.AGGREGATION, AggregateMedian)
+	}
+}
+
+func TestKeySpecNeedsMaxValue(t *testing.T) {
+	key := KeySpec{KEY: "t1", VALUE: "20"}
+	if err := key.Validate(TypeInt, 0); err == nil {
+		t.Fatalf("key without a lie, a range or a max value validates to %s..%s", key.LOW, key.HIGH)
+	}
+	for _, key := range []KeySpec{
+		{KEY: "t1", VALUE: "20", LIE: "9"},
+		{KEY: "t1", VALUE: "20", LOW: "30", HIGH: "40"},
+	} {
+		if err := key.Validate(TypeInt, 0); err != nil {
+			t.Errorf("key %s=%s: %v", key.KEY, key.VALUE, err)
+		}
+	}
+	if err := key.Validate(TypeInt, 50); err != nil || key.HIGH != "50" {
+		t.Errorf("key with max value 50: liars draw up to %s, %v", key.HIGH, err)
+	}
+}
+
+// registryHelper, when set, makes TestRegistryKeepsConcurrentUpdates
+// register the games of a helper process in the current directory
+const registryHelper = "LIARSLIE_REGISTRY_HELPER"
+
+// `registerTestGames` registers `n` games whose IDs start with `prefix`
+func registerTestGames(prefix string, n int) error {
+	for i := 0; i < n; i++ {
+		if err := RegisterGame(GameEntry{GAMEID: fmt.Sprintf("%s%04d", prefix, i), CONFIG: DefaultConfig}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRegistryKeepsConcurrentUpdates(t *testing.T) {
+	if prefix := os.Getenv(registryHelper); prefix != "" {
+		if err := registerTestGames(prefix, 25); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	inTempDir(t)
+
+	// helper processes and goroutines of this one update the
+	// registry at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for _, prefix := range []string{"a", "b"} {
+		helper := exec.Command(os.Args[0], "-test.run=^TestRegistryKeepsConcurrentUpdates$")
+		helper.Env = append(os.Environ(), registryHelper+"="+prefix)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := helper.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("%v: %s", err, out)
+			}
+		}()
+	}
+	for _, prefix := range []string{"c", "d"} {
+		prefix := prefix
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := registerTestGames(prefix, 25); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	games, err := ListGames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 100 {
+		t.Fatalf("the registry holds %d games, want 100", len(games))
+	}
+	for i := 0; i < 100; i += 2 {
+		if err := UnregisterGame(games[i].GAMEID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if games, err = ListGames(); err != nil || len(games) != 50 {
+		t.Errorf("the registry holds %d games after removing half, want 50: %v", len(games), err)
+	}
+}
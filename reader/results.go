@@ -0,0 +1,185 @@
+package reader
+
+import (
+	"strconv"
+	"time"
+)
+
+// GameResult is the structured outcome of a round: the value the
+// network and each agent decided on, compared with the ground truth
+type GameResult struct {
+	GAME string
+	MODE string
+	SEED int64
+	// ROUNDS is the number of rounds played in the game so far
+	ROUNDS int
+	// VALUES describes the values of the game
+	VALUES ValueSpec
+	TRUTH  Value
+	LIARS  []string
+	// DECIDED is the value computed by the network, empty if none
+	DECIDED Value
+	CORRECT bool
+	// ACCURACY is the share of honest agents that decided the truth
+	ACCURACY float64
+	// KEYS is the outcome of every key of a game of keys
+	KEYS     []KeyResult `json:",omitempty"`
+	MESSAGES int
+	DURATION time.Duration
+	AGENTS   []AgentRecord
+}
+
+// KeyResult is the outcome of a round for a key of a game of keys
+type KeyResult struct {
+	KEY   string
+	TRUTH Value
+	// DECIDED is the value the network decided for the key, empty
+	// if none
+	DECIDED Value
+	CORRECT bool
+	// ACCURACY is the share of honest agents that decided the truth
+	// of the key
+	ACCURACY float64
+}
+
+// `ResultOfRound` builds the result of a round recorded in the
+// ledger. Rounds recorded before values were typed decided on the
+// highest int value their agents decided on.
+func ResultOfRound(record RoundRecord) GameResult {
+	result := GameResult{
+		GAME:     record.GAME,
+		MODE:     record.MODE,
+		SEED:     record.SEED,
+		ROUNDS:   record.ROUND,
+		VALUES:   DefaultValueSpec,
+		TRUTH:    record.TRUTH,
+		LIARS:    []string{},
+		DECIDED:  record.DECIDED,
+		DURATION: record.DURATION,
+		AGENTS:   record.AGENTS,
+	}
+	if record.VALUES != nil {
+		result.VALUES = *record.VALUES
+	}
+	highest := -1
+	for _, agent := range record.AGENTS {
+		if agent.LIAR {
+			result.LIARS = append(result.LIARS, agent.USER)
+		}
+		if value, err := strconv.Atoi(agent.DECIDED); err == nil && value > highest {
+			highest = value
+		}
+		result.MESSAGES += agent.RECEIVED
+	}
+	if record.VALUES == nil && highest >= 0 {
+		result.DECIDED = IntValue(highest)
+	}
+	result.CORRECT = result.DECIDED != "" && result.DECIDED == record.TRUTH
+	result.ACCURACY = accuracy(result.AGENTS, record.TRUTH)
+	result.KEYS = keyResults(result.VALUES, result.TRUTH, result.DECIDED, result.AGENTS)
+	return result
+}
+
+// `ResultOfValues` builds the result of game `game` from the values
+// `agents` stand by, `values[i]` being the value of `agents[i]`.
+// What the agents reported and received is taken from the last
+// round in the ledger. The values are those of `spec`.
+func ResultOfValues(game string, agents []ParticipantSet, values []string, spec ValueSpec, decided Value) GameResult {
+	var last RoundRecord
+	records, _ := ReadLedger(game)
+	if len(records) > 0 {
+		last = records[len(records)-1]
+	}
+	truth, _ := ReadGroundTruth(game)
+	liars := make(map[string]bool)
+	for _, liar := range truth.LIARS {
+		liars[liar] = true
+	}
+	recorded := make(map[string]AgentRecord)
+	for _, agent := range last.AGENTS {
+		recorded[agent.USER] = agent
+	}
+
+	result := GameResult{
+		GAME:     game,
+		MODE:     RoleExpert,
+		SEED:     last.SEED,
+		ROUNDS:   len(records),
+		VALUES:   spec,
+		TRUTH:    truth.VALUE,
+		LIARS:    []string{},
+		DECIDED:  decided,
+		CORRECT:  decided != "" && decided == truth.VALUE,
+		DURATION: last.DURATION,
+		AGENTS:   []AgentRecord{},
+	}
+	for i, agent := range agents {
+		record := recorded[agent.USER]
+		record.USER = agent.USER
+		record.LIAR = liars[agent.USER]
+		record.DECIDED = values[i]
+		if record.LIAR {
+			result.LIARS = append(result.LIARS, agent.USER)
+		}
+		result.MESSAGES += record.RECEIVED
+		result.AGENTS = append(result.AGENTS, record)
+	}
+	result.ACCURACY = accuracy(result.AGENTS, truth.VALUE)
+	result.KEYS = keyResults(result.VALUES, result.TRUTH, result.DECIDED, result.AGENTS)
+	return result
+}
+
+// `keyResults` compares the facts the network and `agents` decided
+// with the true facts `truth`, key by key. It is nil unless `values`
+// has keys.
+func keyResults(values ValueSpec, truth Value, decided Value, agents []AgentRecord) []KeyResult {
+	if len(values.KEYS) == 0 {
+		return nil
+	}
+	truthFacts, _ := values.Facts(truth)
+	decidedFacts, _ := values.Facts(decided)
+	agentFacts := make([]Facts, len(agents))
+	for i, agent := range agents {
+		agentFacts[i], _ = values.Facts(Value(agent.DECIDED))
+	}
+
+	results := make([]KeyResult, 0, len(values.KEYS))
+	for _, key := range values.KEYS {
+		result := KeyResult{KEY: key, TRUTH: truthFacts[key], DECIDED: decidedFacts[key]}
+		result.CORRECT = result.DECIDED != "" && result.DECIDED == result.TRUTH
+		honest, correct := 0, 0
+		for i, agent := range agents {
+			if agent.LIAR {
+				continue
+			}
+			honest++
+			if result.TRUTH != "" && agentFacts[i][key] == result.TRUTH {
+				correct++
+			}
+		}
+		if honest > 0 {
+			result.ACCURACY = float64(correct) / float64(honest)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// `accuracy` is the share of the honest agents among `agents` that
+// decided `truth`. Liars stand by their lie.
+func accuracy(agents []AgentRecord, truth Value) float64 {
+	honest, correct := 0, 0
+	for _, agent := range agents {
+		if agent.LIAR {
+			continue
+		}
+		honest++
+		if truth != "" && agent.DECIDED == string(truth) {
+			correct++
+		}
+	}
+	if honest == 0 {
+		return 0
+	}
+	return float64(correct) / float64(honest)
+}
@@ -0,0 +1,248 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// protocols a scenario can run
+const (
+	ProtocolStandard = "standard"
+	ProtocolExpert   = "expert"
+)
+
+// honesty models of an agent group
+const (
+	// HonestyHonest agents observe the true value
+	HonestyHonest = "honest"
+	// HonestyLiar agents all observe the VALUE of their group
+	HonestyLiar = "liar"
+	// HonestyRandom agents each observe a random false value
+	// between 0 and MAX-VALUE of the scenario
+	HonestyRandom = "random"
+)
+
+// scenario events
+const (
+	EventJoin      = "join"
+	EventKill      = "kill"
+	EventPartition = "partition"
+	EventCrash     = "crash"
+	// EventHeal ends a partition. It is scheduled by the runner
+	// when a partition has a DURATION.
+	EventHeal = "heal"
+)
+
+// DefaultRoundTimeout bounds a standard round of a scenario, so that
+// agents cut off by a partition or crash do not wait forever
+const DefaultRoundTimeout = 5 * time.Second
+
+// Scenario describes an entire experiment: the agents of a game,
+// the events happening to them and the protocol they run.
+// Times are offsets from the start of the run.
+type Scenario struct {
+	NAME     string
+	PROTOCOL string
+	// SEED drives every random choice of the run, see `SetSeed`.
+	// Zero picks a random seed.
+	SEED      int64
+	VALUE     int
+	MAXVALUE  int `mapstructure:"max-value"`
+	TRANSPORT string
+	PORTRANGE string `mapstructure:"port-range"`
+	// CONFIG is the agents config of the game, RESULTS the file
+	// the results are written to
+	CONFIG  string
+	RESULTS string
+	// PLAY is when the round starts, TIMEOUT bounds a standard round
+	PLAY    time.Duration
+	TIMEOUT time.Duration
+	GROUPS  []AgentGroup
+	EVENTS  []ScenarioEvent
+}
+
+// AgentGroup is a set of agents sharing an honesty model
+type AgentGroup struct {
+	NAME      string
+	COUNT     int
+	HONESTY   string
+	VALUE     int
+	TRANSPORT string
+}
+
+// ScenarioEvent happens to the game at time AT.
+//   - join adds GROUP to the game
+//   - kill removes the value of the targeted agents
+//   - crash takes the targeted agents off the network
+//   - partition splits the network into SIDES, given as lists of
+//     groups, and heals after DURATION if set
+//
+// kill and crash target AGENTS by name, or the first COUNT agents
+// of GROUP (all of them if COUNT is 0).
+type ScenarioEvent struct {
+	AT       time.Duration
+	TYPE     string
+	GROUP    string
+	AGENTS   []string
+	COUNT    int
+	SIDES    [][]string
+	DURATION time.Duration
+}
+
+// `Validate` fills in the defaults of a scenario and checks it
+func (s *Scenario) Validate() error {
+	s.setDefaults()
+
+	if s.PROTOCOL != ProtocolStandard && s.PROTOCOL != ProtocolExpert {
+		return fmt.Errorf("unknown protocol %q", s.PROTOCOL)
+	}
+	if !ValidTransport(s.TRANSPORT) {
+		return fmt.Errorf("unknown transport %q", s.TRANSPORT)
+	}
+	if _, err := ParsePortRange(s.PORTRANGE); err != nil {
+		return err
+	}
+	if len(s.GROUPS) == 0 {
+		return fmt.Errorf("scenario %s has no agent groups", s.NAME)
+	}
+
+	groups := make(map[string]bool)
+	for _, group := range s.GROUPS {
+		if group.NAME == "" {
+			return fmt.Errorf("agent group without a name")
+		}
+		if groups[group.NAME] {
+			return fmt.Errorf("duplicate agent group %s", group.NAME)
+		}
+		groups[group.NAME] = true
+		if group.COUNT < 1 {
+			return fmt.Errorf("group %s: count must be at least 1", group.NAME)
+		}
+		if !ValidTransport(group.TRANSPORT) {
+			return fmt.Errorf("group %s: unknown transport %q", group.NAME, group.TRANSPORT)
+		}
+		switch group.HONESTY {
+		case HonestyHonest:
+		case HonestyLiar:
+			if group.VALUE == s.VALUE {
+				return fmt.Errorf("group %s: liars must observe a value other than %d", group.NAME, s.VALUE)
+			}
+		case HonestyRandom:
+			if s.MAXVALUE < 1 {
+				return fmt.Errorf("group %s: random liars need a max-value of at least 1", group.NAME)
+			}
+		default:
+			return fmt.Errorf("group %s: unknown honesty %q", group.NAME, group.HONESTY)
+		}
+	}
+
+	joined := make(map[string]bool)
+	for i, event := range s.EVENTS {
+		if event.AT < 0 {
+			return fmt.Errorf("event %d: negative time %s", i+1, event.AT)
+		}
+		switch event.TYPE {
+		case EventJoin:
+			if !groups[event.GROUP] {
+				return fmt.Errorf("event %d: unknown group %q", i+1, event.GROUP)
+			}
+			if joined[event.GROUP] {
+				return fmt.Errorf("event %d: group %s joins twice", i+1, event.GROUP)
+			}
+			if event.AT > s.PLAY {
+				return fmt.Errorf("event %d: agents can only join before the round starts at %s", i+1, s.PLAY)
+			}
+			joined[event.GROUP] = true
+		case EventKill, EventCrash:
+			if len(event.AGENTS) == 0 && !groups[event.GROUP] {
+				return fmt.Errorf("event %d: %s needs agents or a known group", i+1, event.TYPE)
+			}
+			if event.COUNT < 0 {
+				return fmt.Errorf("event %d: negative count", i+1)
+			}
+			if event.TYPE == EventCrash && s.PROTOCOL == ProtocolExpert && event.AT > s.PLAY {
+				return fmt.Errorf("event %d: expert agents can only crash before the round starts at %s", i+1, s.PLAY)
+			}
+		case EventPartition:
+			if s.PROTOCOL != ProtocolStandard {
+				return fmt.Errorf("event %d: partitions are only supported by the standard protocol", i+1)
+			}
+			if len(event.SIDES) == 0 {
+				return fmt.Errorf("event %d: partition has no sides", i+1)
+			}
+			for _, side := range event.SIDES {
+				for _, group := range side {
+					if !groups[group] {
+						return fmt.Errorf("event %d: unknown group %q", i+1, group)
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("event %d: unknown event %q", i+1, event.TYPE)
+		}
+	}
+	if len(joined) == len(groups) {
+		return fmt.Errorf("scenario %s has no agents when it starts", s.NAME)
+	}
+	return nil
+}
+
+// `setDefaults` fills in the fields a scenario may leave out
+func (s *Scenario) setDefaults() {
+	if s.NAME == "" {
+		s.NAME = "scenario"
+	}
+	if s.PROTOCOL == "" {
+		s.PROTOCOL = ProtocolStandard
+	}
+	if s.TRANSPORT == "" {
+		s.TRANSPORT = TransportTCP
+	}
+	if s.CONFIG == "" {
+		s.CONFIG = s.NAME + "-agents.json"
+	}
+	if s.RESULTS == "" {
+		s.RESULTS = s.NAME + "-results.json"
+	}
+	if s.TIMEOUT == 0 {
+		s.TIMEOUT = DefaultRoundTimeout
+	}
+	for i := range s.GROUPS {
+		if s.GROUPS[i].HONESTY == "" {
+			s.GROUPS[i].HONESTY = HonestyHonest
+		}
+		if s.GROUPS[i].TRANSPORT == "" {
+			s.GROUPS[i].TRANSPORT = s.TRANSPORT
+		}
+	}
+}
+
+// EventRecord is an event as it was applied during a run
+type EventRecord struct {
+	AT     time.Duration
+	TYPE   string
+	AGENTS []string
+}
+
+// ScenarioResult is the outcome of a scenario run: the result of its
+// round, and what happened to its agents before and during it
+type ScenarioResult struct {
+	SCENARIO string
+	GameResult
+	// STARTED and ELAPSED cover the whole run, events included
+	STARTED time.Time
+	ELAPSED time.Duration
+	GROUPS  map[string][]string
+	EVENTS  []EventRecord
+}
+
+// `WriteScenarioResult` writes the result of a run to `file`
+func WriteScenarioResult(file string, result ScenarioResult) error {
+	dataBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, dataBytes, 0644)
+}
@@ -0,0 +1,296 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ConfigVersion is the schema version of the agents config written
+// by this build. Version 0 is the legacy bare list of agents and
+// version 1 added the game ID.
+const ConfigVersion = 2
+
+// roles of an agent, recorded by the command that added it
+const (
+	RoleStandard = "standard"
+	RoleExpert   = "expert"
+)
+
+// migrations[v] upgrades a config from version v to version v+1
+var migrations = []func(game *GameConfig) error{
+	// the bare list has been wrapped into a game by `ParseGameConfig`
+	func(game *GameConfig) error { return nil },
+	migrateToV2,
+}
+
+// `migrateToV2` stamps the creation time of the game and fills in
+// the peer ID and transport of agents that predate them. Roles of
+// such agents are unknown and stay empty.
+func migrateToV2(game *GameConfig) error {
+	if entry, ok := FindGame(game.GAMEID); ok {
+		game.CREATEDAT = entry.CREATED
+	} else {
+		game.CREATEDAT = time.Now()
+	}
+	for i := range game.AGENTS {
+		agent := &game.AGENTS[i]
+		if agent.TRANSPORT == "" {
+			agent.TRANSPORT = addressTransport(agent.IP)
+		}
+		if agent.PEERID != "" || game.GAMEID == "" {
+			continue
+		}
+		if key, err := LoadIdentity(GameKeystoreDir(game.GAMEID), agent.USER); err == nil {
+			if id, err := peer.IDFromPrivateKey(key); err == nil {
+				agent.PEERID = id.Pretty()
+			}
+		}
+	}
+	return nil
+}
+
+// `ParseGameConfig` decodes an agents config of any known version
+// and migrates it to ConfigVersion. It reports whether a migration
+// took place. Unknown fields are rejected.
+func ParseGameConfig(data []byte) (GameConfig, bool, error) {
+	var game GameConfig
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		game.VERSION = ConfigVersion
+		return game, false, nil
+	}
+	if trimmed[0] == '[' {
+		if err := decodeStrict(data, &game.AGENTS); err != nil {
+			return game, false, err
+		}
+	} else if err := decodeStrict(data, &game); err != nil {
+		return game, false, err
+	} else if game.VERSION == 0 {
+		// objects were introduced with version 1
+		game.VERSION = 1
+	}
+	if game.VERSION > ConfigVersion {
+		return game, false, fmt.Errorf("unsupported config version %d", game.VERSION)
+	}
+
+	migrated := game.VERSION < ConfigVersion
+	for ; game.VERSION < ConfigVersion; game.VERSION++ {
+		if err := migrations[game.VERSION](&game); err != nil {
+			return game, false, err
+		}
+	}
+	return game, migrated, nil
+}
+
+// `decodeStrict` unmarshals `data` rejecting unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ConfigError is a problem found in an agents config
+type ConfigError struct {
+	LINE int
+	MSG  string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.LINE, e.MSG)
+}
+
+// `ValidateGameConfig` checks an agents config for syntax errors,
+// duplicate agents and peer IDs, port collisions, malformed
+// multiaddrs and inconsistent transports. Every problem is
+// reported with the line of the offending agent.
+func ValidateGameConfig(data []byte) []ConfigError {
+	game, _, err := ParseGameConfig(data)
+	if err != nil {
+		return []ConfigError{{LINE: errorLine(data, err), MSG: err.Error()}}
+	}
+	lines, err := agentLines(data)
+	if err != nil {
+		return []ConfigError{{LINE: errorLine(data, err), MSG: err.Error()}}
+	}
+
+	var errs []ConfigError
+	report := func(i int, format string, args ...interface{}) {
+		errs = append(errs, ConfigError{LINE: lines[i], MSG: fmt.Sprintf(format, args...)})
+	}
+	if game.VALUES != nil {
+		spec := *game.VALUES
+		if err := spec.Validate(); err != nil {
+			line := 1
+			if offset := bytes.Index(data, []byte(`"VALUES"`)); offset >= 0 {
+				line = lineAt(data, offset)
+			}
+			errs = append(errs, ConfigError{LINE: line, MSG: err.Error()})
+		}
+	}
+	users := make(map[string]int)
+	peerIDs := make(map[string]int)
+	ports := make(map[string]int)
+	for i, agent := range game.AGENTS {
+		if agent.USER == "" {
+			report(i, "agent has no name")
+		} else if first, ok := users[agent.USER]; ok {
+			report(i, "duplicate agent %s, first defined on line %d", agent.USER, lines[first])
+		} else {
+			users[agent.USER] = i
+		}
+
+		if agent.PEERID != "" {
+			if _, err := peer.Decode(agent.PEERID); err != nil {
+				report(i, "malformed peer ID %q", agent.PEERID)
+			} else if first, ok := peerIDs[agent.PEERID]; ok {
+				report(i, "duplicate peer ID %s, first used on line %d", agent.PEERID, lines[first])
+			} else {
+				peerIDs[agent.PEERID] = i
+			}
+		}
+
+		switch agent.ROLE {
+		case "", RoleStandard, RoleExpert:
+		default:
+			report(i, "unknown role %q", agent.ROLE)
+		}
+
+		addr, err := ma.NewMultiaddr(agent.IP)
+		if err != nil {
+			report(i, "malformed multiaddr: %v", err)
+			continue
+		}
+		transport := addressTransport(agent.IP)
+		if transport == "" {
+			report(i, "multiaddr %s does not use a supported transport", agent.IP)
+			continue
+		}
+		if agent.TRANSPORT != "" && agent.TRANSPORT != transport {
+			report(i, "transport %s does not match multiaddr %s", agent.TRANSPORT, agent.IP)
+		}
+		port := socketOf(addr)
+		if first, ok := ports[port]; ok {
+			report(i, "port %s already used by %s on line %d", port, game.AGENTS[first].USER, lines[first])
+		} else {
+			ports[port] = i
+		}
+	}
+	return errs
+}
+
+// `addressTransport` infers the transport of a listen multiaddr,
+// returning "" if it uses none of the supported transports
+func addressTransport(addr string) string {
+	m, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return ""
+	}
+	has := func(code int) bool {
+		_, err := m.ValueForProtocol(code)
+		return err == nil
+	}
+	switch {
+	case has(ma.P_QUIC_V1):
+		return TransportQUIC
+	case has(ma.P_WS):
+		return TransportWS
+	case has(ma.P_TCP):
+		return TransportTCP
+	}
+	return ""
+}
+
+// `socketOf` names the port a multiaddr binds, e.g. "tcp/4001"
+func socketOf(addr ma.Multiaddr) string {
+	if port, err := addr.ValueForProtocol(ma.P_TCP); err == nil {
+		return "tcp/" + port
+	}
+	port, _ := addr.ValueForProtocol(ma.P_UDP)
+	return "udp/" + port
+}
+
+// `agentLines` returns the line on which each agent of a config
+// starts, walking the JSON tokens of the file
+func agentLines(data []byte) ([]int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok == json.Delim('{') {
+		// skip to the AGENTS list of a versioned config
+		for {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if key == json.Delim('}') {
+				return nil, nil
+			}
+			if name, ok := key.(string); ok && strings.EqualFold(name, "AGENTS") {
+				if tok, err = dec.Token(); err != nil {
+					return nil, err
+				}
+				break
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tok != json.Delim('[') {
+		// AGENTS is null
+		return nil, nil
+	}
+
+	var lines []int
+	for dec.More() {
+		lines = append(lines, lineAt(data, skipSeparators(data, int(dec.InputOffset()))))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// `skipSeparators` moves `offset` past whitespace and commas
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) && bytes.IndexByte([]byte(" \t\r\n,"), data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// `lineAt` is the 1-based line of byte `offset` in `data`
+func lineAt(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// `errorLine` locates a decoding error in `data`, defaulting to line 1
+func errorLine(data []byte, err error) int {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return lineAt(data, int(syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		return lineAt(data, int(typeErr.Offset))
+	}
+	return 1
+}
@@ -0,0 +1,150 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGameConfigMigratesLegacyList(t *testing.T) {
+	inTempDir(t)
+	data := []byte(`[
+  {"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001"},
+  {"USER": "b", "IP": "/ip4/127.0.0.1/udp/4002/quic-v1"}
+]`)
+	before := time.Now()
+	game, migrated, err := ParseGameConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrated {
+		t.Error("a legacy list was not migrated")
+	}
+	if game.VERSION != ConfigVersion || game.GAMEID != "" || len(game.AGENTS) != 2 {
+		t.Fatalf("migrated to version %d, game %q with %d agents", game.VERSION, game.GAMEID, len(game.AGENTS))
+	}
+	if game.CREATEDAT.Before(before) {
+		t.Errorf("a game outside the registry was created at %v", game.CREATEDAT)
+	}
+	for i, want := range []string{TransportTCP, TransportQUIC} {
+		if agent := game.AGENTS[i]; agent.TRANSPORT != want || agent.PEERID != "" {
+			t.Errorf("%s has transport %q and peer ID %q, want %q and none", agent.USER, agent.TRANSPORT, agent.PEERID, want)
+		}
+	}
+}
+
+func TestParseGameConfigMigratesV1(t *testing.T) {
+	inTempDir(t)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := RegisterGame(GameEntry{GAMEID: "5c4e0001", CONFIG: DefaultConfig, CREATED: created}); err != nil {
+		t.Fatal(err)
+	}
+	id, err := GenerateIdentity(GameKeystoreDir("5c4e0001"), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// objects without a version are version 1
+	for _, data := range []string{
+		`{"VERSION": 1, "GAMEID": "5c4e0001", "AGENTS": [{"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001/ws"}]}`,
+		`{"GAMEID": "5c4e0001", "AGENTS": [{"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001/ws"}]}`,
+	} {
+		game, migrated, err := ParseGameConfig([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !migrated || game.VERSION != ConfigVersion {
+			t.Errorf("%s: migrated %v to version %d", data, migrated, game.VERSION)
+		}
+		if !game.CREATEDAT.Equal(created) {
+			t.Errorf("%s: created at %v, want the registry's %v", data, game.CREATEDAT, created)
+		}
+		if agent := game.AGENTS[0]; agent.PEERID != id.Pretty() || agent.TRANSPORT != TransportWS {
+			t.Errorf("%s: agent has peer ID %q and transport %q, want %s from the keystore and %q", data, agent.PEERID, agent.TRANSPORT, id, TransportWS)
+		}
+	}
+}
+
+func TestParseGameConfigCurrentVersion(t *testing.T) {
+	inTempDir(t)
+	data := []byte(`{"VERSION": 2, "GAMEID": "5c4e0002", "CREATEDAT": "2024-03-01T12:00:00Z", "AGENTS": [{"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001"}]}`)
+	game, migrated, err := ParseGameConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated {
+		t.Error("a current config was migrated")
+	}
+	// migrations fill in transports, current configs are taken as is
+	if game.AGENTS[0].TRANSPORT != "" {
+		t.Errorf("transport %q was filled in", game.AGENTS[0].TRANSPORT)
+	}
+
+	if game, migrated, err := ParseGameConfig([]byte("  \n")); err != nil || migrated || game.VERSION != ConfigVersion {
+		t.Errorf("an empty config parsed to version %d, migrated %v: %v", game.VERSION, migrated, err)
+	}
+	for _, data := range []string{
+		`{"VERSION": 3, "AGENTS": []}`,
+		`{"VERSION": 2, "PLAYERS": []}`,
+		`[{"USER": "a", "NAME": "b"}]`,
+	} {
+		if _, _, err := ParseGameConfig([]byte(data)); err == nil {
+			t.Errorf("%s parsed", data)
+		}
+	}
+}
+
+func TestValidateGameConfigLines(t *testing.T) {
+	inTempDir(t)
+	peerID, err := GenerateIdentity(GameKeystoreDir("5c4e0003"), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{
+  "VERSION": 2,
+  "GAMEID": "5c4e0003",
+  "AGENTS": [
+    {"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001", "PEERID": "` + peerID.Pretty() + `"},
+    {"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4002"},
+    {"USER": "c", "IP": "/ip4/127.0.0.1/tcp/4001"},
+    {"USER": "d", "IP": "/ip4/127.0.0.1/tcp/4004", "PEERID": "` + peerID.Pretty() + `"},
+    {"USER": "e", "IP": "/ip4/127.0.0.1/tcp/4005", "TRANSPORT": "quic"},
+    {"USER": "f", "IP": "not an address"},
+    {"USER": "g", "IP": "/ip4/127.0.0.1/tcp/4007", "ROLE": "judge"},
+    {"IP": "/ip4/127.0.0.1/tcp/4008"},
+    {"USER": "i", "IP": "/ip4/127.0.0.1/tcp/4009", "PEERID": "nope"}
+  ]
+}`)
+	want := []struct {
+		line int
+		msg  string
+	}{
+		{6, "duplicate agent a, first defined on line 5"},
+		{7, "port tcp/4001 already used by a on line 5"},
+		{8, "duplicate peer ID"},
+		{9, "transport quic does not match"},
+		{10, "malformed multiaddr"},
+		{11, `unknown role "judge"`},
+		{12, "agent has no name"},
+		{13, `malformed peer ID "nope"`},
+	}
+	errs := ValidateGameConfig(data)
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, err := range errs {
+		if err.LINE != want[i].line || !strings.Contains(err.MSG, want[i].msg) {
+			t.Errorf("error %d is %v, want line %d: %s", i, err, want[i].line, want[i].msg)
+		}
+	}
+}
+
+func TestValidateGameConfigSyntaxLine(t *testing.T) {
+	data := []byte("[\n  {\"USER\": \"a\", \"IP\": \"/ip4/127.0.0.1/tcp/4001\"},\n  {\"USER\": \"b\",, }\n]")
+	errs := ValidateGameConfig(data)
+	if len(errs) != 1 || errs[0].LINE != 3 {
+		t.Errorf("got %v, want a single error on line 3", errs)
+	}
+	if errs := ValidateGameConfig([]byte(`[{"USER": "a", "IP": "/ip4/127.0.0.1/tcp/4001"}]`)); len(errs) != 0 {
+		t.Errorf("a valid legacy list has errors: %v", errs)
+	}
+}
@@ -0,0 +1,365 @@
+package reader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotVersion is the archive format written by `SaveSnapshot`
+const SnapshotVersion = 2
+
+// entries of a snapshot archive
+const (
+	manifestEntry = "manifest.json"
+	manifestSum   = "manifest.sha256"
+	configEntry   = "agents.json"
+	truthEntry    = "truth.json"
+	ledgerEntry   = "ledger.jsonl"
+	keystorePath  = "keystore/"
+	vaultsPath    = "vaults/"
+)
+
+// SnapshotManifest describes the content of a snapshot archive.
+// FILES maps every entry to its SHA-256 checksum; the checksum of
+// the manifest itself is the manifestSum entry.
+type SnapshotManifest struct {
+	VERSION int
+	GAMEID  string
+	CREATED time.Time
+	FILES   map[string]string
+}
+
+// `SaveSnapshot` bundles the game in `config` with its agent keys,
+// vault contents, ground truth and ledger into the archive `file`.
+// `pairs` returns the pairs in the vault of an agent; vaults of
+// agents run by a daemon are held by the daemon.
+func SaveSnapshot(config string, file string, pairs func(agent string) (map[string][]byte, error)) error {
+	game, err := ReadGameConfig(config)
+	if err != nil {
+		return err
+	}
+	if game.GAMEID == "" {
+		return errors.New("config does not hold a game")
+	}
+
+	entries := make(map[string][]byte)
+	if entries[configEntry], err = ioutil.ReadFile(config); err != nil {
+		return err
+	}
+	if truth, err := ioutil.ReadFile(filepath.Join(StorageDir(game.GAMEID), truthFile)); err == nil {
+		entries[truthEntry] = truth
+	}
+	if ledger, err := ioutil.ReadFile(ledgerPath(game.GAMEID)); err == nil {
+		entries[ledgerEntry] = ledger
+	}
+	for _, agent := range game.AGENTS {
+		key, err := ioutil.ReadFile(keyPath(GameKeystoreDir(game.GAMEID), agent.USER))
+		if err != nil {
+			return err
+		}
+		entries[keystorePath+agent.USER+".key"] = key
+
+		vault, err := pairs(agent.USER)
+		if err != nil {
+			return fmt.Errorf("vault of %s: %w", agent.USER, err)
+		}
+		if entries[vaultsPath+agent.USER+".json"], err = json.Marshal(vault); err != nil {
+			return err
+		}
+	}
+
+	manifest := SnapshotManifest{
+		VERSION: SnapshotVersion,
+		GAMEID:  game.GAMEID,
+		CREATED: time.Now(),
+		FILES:   make(map[string]string),
+	}
+	for name, data := range entries {
+		manifest.FILES[name] = checksum(data)
+	}
+	if entries[manifestEntry], err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		return err
+	}
+	entries[manifestSum] = []byte(checksum(entries[manifestEntry]) + "\n")
+
+	return writeArchive(file, entries)
+}
+
+// Snapshot is a snapshot archive verified by `OpenSnapshot`
+type Snapshot struct {
+	MANIFEST SnapshotManifest
+	entries  map[string][]byte
+	game     GameConfig
+	// keepLedger is set if the local ledger of the game has rounds
+	// played after the snapshot was saved
+	keepLedger bool
+}
+
+// `OpenSnapshot` reads the archive `file` and verifies it. The
+// ledger of the archive must share its history with the ledger
+// kept on this machine for the game, if any, so that a restore
+// never rewrites rounds: the longer of the two is kept.
+func OpenSnapshot(file string) (*Snapshot, error) {
+	entries, err := readArchive(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := verifySnapshot(entries)
+	if err != nil {
+		return nil, err
+	}
+	game, _, err := ParseGameConfig(entries[configEntry])
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{MANIFEST: manifest, entries: entries, game: game}
+
+	var saved []RoundRecord
+	if ledger, ok := entries[ledgerEntry]; ok {
+		if saved, err = parseLedger(bytes.NewReader(ledger)); err != nil {
+			return nil, fmt.Errorf("snapshot ledger: %w", err)
+		}
+		if err := VerifyLedger(saved); err != nil {
+			return nil, fmt.Errorf("snapshot ledger: %w", err)
+		}
+	}
+	local, err := ReadLedger(game.GAMEID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	switch {
+	case ledgerPrefix(local, saved):
+	case ledgerPrefix(saved, local):
+		s.keepLedger = true
+	default:
+		return nil, fmt.Errorf("the ledger of game %s on this machine does not share the history of the snapshot", game.GAMEID)
+	}
+	return s, nil
+}
+
+// `ledgerPrefix` reports whether the ledger `a` is the start of
+// the ledger `b`
+func ledgerPrefix(a []RoundRecord, b []RoundRecord) bool {
+	if len(a) > len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].HASH != b[i].HASH {
+			return false
+		}
+	}
+	return true
+}
+
+// `Restore` restores the game of the snapshot into `config`,
+// replacing any state left by that game. A `config` holding
+// another game is refused; its game must be reset first. Running
+// agents of the game must be shut down, they hold their vaults.
+func (s *Snapshot) Restore(config string) error {
+	game := s.game
+	if other := GetGameID(config); other != "" && other != game.GAMEID {
+		return fmt.Errorf("%s holds game %s, reset it before restoring game %s", config, other, game.GAMEID)
+	}
+
+	// start from a clean slate for this game
+	CloseVaults()
+	RemoveGameArtifacts(game.GAMEID)
+	UnregisterGame(game.GAMEID)
+	if err := os.MkdirAll(StorageDir(game.GAMEID), 0755); err != nil {
+		return err
+	}
+
+	for _, agent := range game.AGENTS {
+		if err := os.MkdirAll(GameKeystoreDir(game.GAMEID), 0700); err != nil {
+			return err
+		}
+		key := s.entries[keystorePath+agent.USER+".key"]
+		if err := ioutil.WriteFile(keyPath(GameKeystoreDir(game.GAMEID), agent.USER), key, 0600); err != nil {
+			return err
+		}
+
+		var pairs map[string][]byte
+		if err := json.Unmarshal(s.entries[vaultsPath+agent.USER+".json"], &pairs); err != nil {
+			return err
+		}
+		db, err := GetAgentVault(game.GAMEID, agent.USER)
+		if err != nil {
+			return err
+		}
+		for k, v := range pairs {
+			if err := db.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+	CloseVaults()
+
+	if truth, ok := s.entries[truthEntry]; ok {
+		if err := ioutil.WriteFile(filepath.Join(StorageDir(game.GAMEID), truthFile), truth, 0600); err != nil {
+			return err
+		}
+	}
+	if ledger, ok := s.entries[ledgerEntry]; ok && !s.keepLedger {
+		if err := os.MkdirAll(ledgerRoot, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(ledgerPath(game.GAMEID), ledger, 0644); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(config, s.entries[configEntry], 0644); err != nil {
+		return err
+	}
+	return RegisterGame(GameEntry{GAMEID: game.GAMEID, CONFIG: config, CREATED: time.Now()})
+}
+
+// `verifySnapshot` checks the version of an archive, that every entry
+// listed in its manifest is present and unaltered, and that it holds
+// a key and a vault for every agent
+func verifySnapshot(entries map[string][]byte) (SnapshotManifest, error) {
+	var manifest SnapshotManifest
+	data, ok := entries[manifestEntry]
+	if !ok {
+		return manifest, errors.New("snapshot has no manifest")
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, err
+	}
+	if manifest.VERSION != SnapshotVersion {
+		return manifest, fmt.Errorf("unsupported snapshot version %d", manifest.VERSION)
+	}
+	sum, ok := entries[manifestSum]
+	if !ok {
+		return manifest, errors.New("snapshot has no manifest checksum")
+	}
+	if strings.TrimSpace(string(sum)) != checksum(data) {
+		return manifest, errors.New("checksum mismatch for the manifest")
+	}
+	// the game ID names the directories restore replaces
+	if err := ValidGameID(manifest.GAMEID); err != nil {
+		return manifest, fmt.Errorf("snapshot: %w", err)
+	}
+
+	for name, sum := range manifest.FILES {
+		data, ok := entries[name]
+		if !ok {
+			return manifest, fmt.Errorf("snapshot is missing %s", name)
+		}
+		if checksum(data) != sum {
+			return manifest, fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	for name := range entries {
+		if _, ok := manifest.FILES[name]; !ok && name != manifestEntry && name != manifestSum {
+			return manifest, fmt.Errorf("snapshot holds unlisted entry %s", name)
+		}
+	}
+
+	game, _, err := ParseGameConfig(entries[configEntry])
+	if err != nil {
+		return manifest, err
+	}
+	if game.GAMEID != manifest.GAMEID {
+		return manifest, fmt.Errorf("config holds game %s, manifest holds game %s", game.GAMEID, manifest.GAMEID)
+	}
+	for _, agent := range game.AGENTS {
+		if agent.USER == "" || agent.USER == ".." || strings.ContainsAny(agent.USER, `/\`) {
+			return manifest, fmt.Errorf("snapshot holds invalid agent name %q", agent.USER)
+		}
+		for _, name := range []string{keystorePath + agent.USER + ".key", vaultsPath + agent.USER + ".json"} {
+			if _, ok := manifest.FILES[name]; !ok {
+				return manifest, fmt.Errorf("snapshot is missing %s", name)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// `checksum` is the hex encoded SHA-256 of `data`
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// `writeArchive` writes the entries to a gzipped tar archive,
+// manifest first and the rest in name order
+func writeArchive(file string, entries map[string][]byte) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		if name != manifestEntry {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{manifestEntry}, names...)
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(entries[name])), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entries[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// `readArchive` reads every entry of a gzipped tar archive
+func readArchive(file string) (map[string][]byte, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("snapshot holds unsafe entry %s", header.Name)
+		}
+		if entries[name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, err
+		}
+	}
+}
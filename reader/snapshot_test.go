@@ -0,0 +1,180 @@
+package reader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `testSnapshot` builds the entries of an archive holding a game
+// without agents, with a manifest claiming game `gameID`
+func testSnapshot(t *testing.T, gameID string) map[string][]byte {
+	t.Helper()
+	config, err := json.Marshal(GameConfig{VERSION: ConfigVersion, GAMEID: gameID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string][]byte{configEntry: config}
+	manifest := SnapshotManifest{
+		VERSION: SnapshotVersion,
+		GAMEID:  gameID,
+		CREATED: time.Now(),
+		FILES:   map[string]string{configEntry: checksum(config)},
+	}
+	if entries[manifestEntry], err = json.Marshal(manifest); err != nil {
+		t.Fatal(err)
+	}
+	entries[manifestSum] = []byte(checksum(entries[manifestEntry]) + "\n")
+	return entries
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	if _, err := verifySnapshot(testSnapshot(t, "5a7e0001")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySnapshotRejectsUnsafeGameIDs(t *testing.T) {
+	for _, id := range []string{"", "../..", "..", "5a7e/../..", "/tmp", "5A7E0001", "5a7e00012"} {
+		_, err := verifySnapshot(testSnapshot(t, id))
+		if err == nil || !strings.Contains(err.Error(), "invalid game ID") {
+			t.Errorf("game ID %q: got %v, want an invalid game ID", id, err)
+		}
+	}
+}
+
+func TestVerifySnapshotChecksManifest(t *testing.T) {
+	entries := testSnapshot(t, "5a7e0001")
+	entries[manifestEntry] = []byte(strings.Replace(string(entries[manifestEntry]), `"CREATED":"`, `"CREATED" : "`, 1))
+	if _, err := verifySnapshot(entries); err == nil || !strings.Contains(err.Error(), "manifest") {
+		t.Errorf("altered manifest: got %v, want a checksum mismatch", err)
+	}
+
+	entries = testSnapshot(t, "5a7e0001")
+	delete(entries, manifestSum)
+	if _, err := verifySnapshot(entries); err == nil {
+		t.Error("snapshot without a manifest checksum was accepted")
+	}
+}
+
+func TestVerifySnapshotRejectsMismatchedGames(t *testing.T) {
+	entries := testSnapshot(t, "5a7e0001")
+	config, _ := json.Marshal(GameConfig{VERSION: ConfigVersion, GAMEID: "../.."})
+	entries[configEntry] = config
+	var manifest SnapshotManifest
+	json.Unmarshal(entries[manifestEntry], &manifest)
+	manifest.FILES[configEntry] = checksum(config)
+	entries[manifestEntry], _ = json.Marshal(manifest)
+	entries[manifestSum] = []byte(checksum(entries[manifestEntry]))
+	if _, err := verifySnapshot(entries); err == nil {
+		t.Error("snapshot whose config holds another game was accepted")
+	}
+}
+
+// `saveTestGame` starts game `id` with agent `a` in agents.json,
+// plays a round and saves the game to game.tgz
+func saveTestGame(t *testing.T, id string) {
+	t.Helper()
+	if err := WriteGameConfig("agents.json", GameConfig{GAMEID: id, AGENTS: []ParticipantSet{{USER: "a"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterGame(GameEntry{GAMEID: id, CONFIG: "agents.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(GameKeystoreDir(id), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath(GameKeystoreDir(id), "a"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendRound(&RoundRecord{GAME: id, MODE: RoleStandard}); err != nil {
+		t.Fatal(err)
+	}
+	err := SaveSnapshot("agents.json", "game.tgz", func(agent string) (map[string][]byte, error) {
+		return map[string][]byte{ValueKey: []byte("5")}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Rounds played after a snapshot was saved stay in the ledger when
+// it is restored
+func TestRestoreSnapshotKeepsLaterRounds(t *testing.T) {
+	inTempDir(t)
+	defer CloseVaults()
+	saveTestGame(t, "5a7e0002")
+	if err := AppendRound(&RoundRecord{GAME: "5a7e0002", MODE: RoleExpert}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := OpenSnapshot("game.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Restore("agents.json"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadLedger("5a7e0002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || VerifyLedger(records) != nil {
+		t.Errorf("restored ledger has %d rounds, want both rounds in one chain", len(records))
+	}
+	if value, err := GetAgentValue("5a7e0002", "a"); err != nil || value != "5" {
+		t.Errorf("restored value %q, %v, want 5", value, err)
+	}
+}
+
+// A ledger with fewer rounds than the snapshot is replaced by the
+// ledger of the snapshot, one that went another way is refused
+func TestRestoreSnapshotLedgerHistory(t *testing.T) {
+	inTempDir(t)
+	defer CloseVaults()
+	saveTestGame(t, "5a7e0003")
+
+	os.Remove(ledgerPath("5a7e0003"))
+	snapshot, err := OpenSnapshot("game.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Restore("agents.json"); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := ReadLedger("5a7e0003"); err != nil || len(records) != 1 {
+		t.Errorf("restored ledger has %d rounds, %v, want the round of the snapshot", len(records), err)
+	}
+
+	os.Remove(ledgerPath("5a7e0003"))
+	if err := AppendRound(&RoundRecord{GAME: "5a7e0003", MODE: RoleExpert}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSnapshot("game.tgz"); err == nil {
+		t.Error("snapshot was accepted over a ledger with another history")
+	}
+}
+
+// A config holding another game is not overwritten
+func TestRestoreSnapshotRefusesAnotherGame(t *testing.T) {
+	inTempDir(t)
+	defer CloseVaults()
+	saveTestGame(t, "5a7e0004")
+	if err := WriteGameConfig("other.json", GameConfig{GAMEID: "07e20000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := OpenSnapshot("game.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Restore("other.json"); err == nil {
+		t.Error("restored over the config of another game")
+	}
+	if game := GetGameID("other.json"); game != "07e20000" {
+		t.Errorf("other.json holds game %q, want 07e20000", game)
+	}
+}
@@ -0,0 +1,57 @@
+package reader
+
+import "fmt"
+
+// transports an agent can listen on
+const (
+	TransportTCP   = "tcp"
+	TransportQUIC  = "quic"
+	TransportWS    = "ws"
+	TransportMixed = "mixed"
+)
+
+// mixedTransports is the rotation used to assign transports
+// to agents in a mixed fleet
+var mixedTransports = []string{TransportTCP, TransportQUIC, TransportWS}
+
+// `ValidTransport` reports whether `transport` can be passed
+// to `start`/`extend`
+func ValidTransport(transport string) bool {
+	switch transport {
+	case TransportTCP, TransportQUIC, TransportWS, TransportMixed:
+		return true
+	}
+	return false
+}
+
+// `AgentTransport` resolves the transport of the i-th agent for
+// the requested fleet transport
+func AgentTransport(transport string, i int) string {
+	if transport == TransportMixed {
+		return mixedTransports[i%len(mixedTransports)]
+	}
+	return transport
+}
+
+// `ListenAddress` builds the multiaddr an agent listens on
+// for the given transport and port
+func ListenAddress(transport string, port int) (string, error) {
+	switch transport {
+	case TransportTCP:
+		return fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port), nil
+	case TransportQUIC:
+		return fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", port), nil
+	case TransportWS:
+		return fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", port), nil
+	}
+	return "", fmt.Errorf("unknown transport %q", transport)
+}
+
+// `GetTransport` returns the transport of an agent. Agents written
+// before transports were recorded always listen on TCP.
+func (p ParticipantSet) GetTransport() string {
+	if p.TRANSPORT == "" {
+		return TransportTCP
+	}
+	return p.TRANSPORT
+}
@@ -0,0 +1,40 @@
+package reader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// truthFile holds the ground truth of a game. It is only
+// read by the reporting layer, never by the agents.
+const truthFile = "truth.json"
+
+// GroundTruth records the true value of a game, which agents were
+// made to lie about it and the lie each of them was given. Truths
+// written before lies were kept have no LIES.
+type GroundTruth struct {
+	VALUE Value
+	LIARS []string
+	LIES  map[string]Value `json:",omitempty"`
+}
+
+// `ReadGroundTruth` reads the ground truth of game `game`
+func ReadGroundTruth(game string) (GroundTruth, error) {
+	var truth GroundTruth
+	file, err := ioutil.ReadFile(filepath.Join(StorageDir(game), truthFile))
+	if err != nil {
+		return truth, err
+	}
+	err = json.Unmarshal(file, &truth)
+	return truth, err
+}
+
+// `WriteGroundTruth` writes the ground truth of game `game`
+func WriteGroundTruth(game string, truth GroundTruth) error {
+	dataBytes, err := json.Marshal(truth)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(StorageDir(game), truthFile), dataBytes, 0600)
+}
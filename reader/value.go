@@ -0,0 +1,407 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// types of the values agents agree on
+const (
+	TypeInt    ValueType = "int"
+	TypeFloat  ValueType = "float"
+	TypeString ValueType = "string"
+	TypeBytes  ValueType = "bytes"
+	TypeStruct ValueType = "struct"
+)
+
+// rules agents decide on a value with
+const (
+	// AggregateMode decides the value reported most often, ties go
+	// to the value received first
+	AggregateMode Aggregation = "mode"
+	// AggregateMedian decides the middle of the values reported,
+	// the lower one for an even number of values
+	AggregateMedian Aggregation = "median"
+	// AggregateTrimmedMean decides the mean of the values reported,
+	// leaving out the lowest and highest trimFraction of them
+	AggregateTrimmedMean Aggregation = "trimmed-mean"
+	// AggregateExact decides a value only if every value reported
+	// is the same
+	AggregateExact Aggregation = "exact"
+)
+
+const (
+	// trimFraction of the values is left out at each end by the
+	// trimmed mean
+	trimFraction = 0.2
+	// maxValueSize bounds the canonical encoding of a value
+	maxValueSize = 1024
+	// maxStructFields bounds the fields of a struct value
+	maxStructFields = 16
+)
+
+// ValueType is the type of the values of a game. It decides how
+// values are encoded and which aggregation rules apply to them.
+type ValueType string
+
+// Aggregation is the rule an agent decides on a value with, given
+// the values its peers reported
+type Aggregation string
+
+// Value is a value in the canonical encoding of its type:
+//
+//	int     decimal, e.g. 42
+//	float   shortest decimal or exponent form, e.g. 0.5 or 1e+21
+//	string  UTF-8 text
+//	bytes   lowercase hex, e.g. 00ff
+//	struct  JSON object with sorted keys and canonical numbers, e.g. {"lat":1.5,"unit":"deg"}
+//
+// Two values of the same type are equal if and only if their
+// encodings are. The empty value stands for no value.
+type Value string
+
+// ValueTypes lists the supported value types
+var ValueTypes = []ValueType{TypeInt, TypeFloat, TypeString, TypeBytes, TypeStruct}
+
+// aggregations are the rules each type supports, its default first
+var aggregations = map[ValueType][]Aggregation{
+	TypeInt:    {AggregateMode, AggregateMedian, AggregateTrimmedMean, AggregateExact},
+	TypeFloat:  {AggregateMedian, AggregateMode, AggregateTrimmedMean, AggregateExact},
+	TypeString: {AggregateMode, AggregateExact},
+	TypeBytes:  {AggregateMode, AggregateExact},
+	TypeStruct: {AggregateMode, AggregateExact},
+}
+
+// `IntValue` is the value of integer `i`
+func IntValue(i int) Value {
+	return Value(strconv.Itoa(i))
+}
+
+// `MarshalJSON` writes integers as JSON numbers, so that truths and
+// ledger records written before values were typed stay the same,
+// other values as JSON strings and the empty value as null
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v == "" {
+		return []byte("null"), nil
+	}
+	if i, err := strconv.ParseInt(string(v), 10, 64); err == nil && strconv.FormatInt(i, 10) == string(v) {
+		return []byte(v), nil
+	}
+	return json.Marshal(string(v))
+}
+
+// `UnmarshalJSON` reads a value written by `MarshalJSON`. Numbers
+// are kept as written.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case string(data) == "null":
+		*v = ""
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*v = Value(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("a value must be a number or a string: %w", err)
+	}
+	*v = Value(n)
+	return nil
+}
+
+// `ValidValueType` reports whether `t` is a supported value type
+func ValidValueType(t ValueType) bool {
+	_, ok := aggregations[t]
+	return ok
+}
+
+// `Numeric` reports whether values of type `t` are numbers
+func (t ValueType) Numeric() bool {
+	return t == TypeInt || t == TypeFloat
+}
+
+// `Aggregations` are the rules values of type `t` can be decided
+// with, the default first
+func (t ValueType) Aggregations() []Aggregation {
+	return aggregations[t]
+}
+
+// `Canonical` parses `s` as a value of type `t` and returns its
+// canonical encoding
+func (t ValueType) Canonical(s string) (Value, error) {
+	if s == "" {
+		return "", fmt.Errorf("empty %s value", t)
+	}
+	if len(s) > maxValueSize {
+		return "", fmt.Errorf("%s value is longer than %d bytes", t, maxValueSize)
+	}
+	switch t {
+	case TypeInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an int", s)
+		}
+		return Value(strconv.FormatInt(i, 10)), nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%q is not a finite float", s)
+		}
+		return floatValue(f), nil
+	case TypeString:
+		if !utf8.ValidString(s) {
+			return "", fmt.Errorf("%q is not UTF-8 text", s)
+		}
+		return Value(s), nil
+	case TypeBytes:
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+		if err != nil || len(data) == 0 {
+			return "", fmt.Errorf("%q is not hex encoded bytes", s)
+		}
+		return Value(hex.EncodeToString(data)), nil
+	case TypeStruct:
+		return canonicalStruct(s)
+	}
+	return "", fmt.Errorf("unknown value type %q", t)
+}
+
+// `floatValue` is the canonical encoding of float `f`
+func floatValue(f float64) Value {
+	if f == 0 {
+		// no negative zero
+		f = 0
+	}
+	return Value(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// `canonicalStruct` encodes a JSON object of at most
+// maxStructFields fields holding strings, numbers and booleans
+// with sorted keys and canonical numbers
+func canonicalStruct(s string) (Value, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		return "", fmt.Errorf("%q is not a JSON object", s)
+	}
+	if dec.More() {
+		return "", fmt.Errorf("%q holds more than a JSON object", s)
+	}
+	if len(fields) > maxStructFields {
+		return "", fmt.Errorf("struct value has more than %d fields", maxStructFields)
+	}
+	for name, field := range fields {
+		switch field := field.(type) {
+		case string, bool:
+		case json.Number:
+			number, err := canonicalNumber(field)
+			if err != nil {
+				return "", fmt.Errorf("field %s: %w", name, err)
+			}
+			fields[name] = number
+		default:
+			return "", fmt.Errorf("field %s must be a string, number or boolean", name)
+		}
+	}
+	// maps are encoded with sorted keys
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return Value(data), nil
+}
+
+// `canonicalNumber` encodes integers in decimal and other numbers
+// like floats
+func canonicalNumber(n json.Number) (json.Number, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return "", fmt.Errorf("%s is out of range", n)
+	}
+	return json.Number(floatValue(f)), nil
+}
+
+// ValueSpec describes the values of a game: their type and the rule
+// agents decide with. Agents of a game of keys agree on a value of
+// the type for each of KEYS, see Facts.
+type ValueSpec struct {
+	TYPE        ValueType
+	AGGREGATION Aggregation `json:",omitempty"`
+	KEYS        []string    `json:",omitempty"`
+}
+
+// DefaultValueSpec is the spec of games that do not set one: int
+// values decided by the most frequent value
+var DefaultValueSpec = ValueSpec{TYPE: TypeInt, AGGREGATION: AggregateMode}
+
+// `Validate` fills in the defaults of the spec and checks that its
+// aggregation applies to its type
+func (s *ValueSpec) Validate() error {
+	if s.TYPE == "" {
+		s.TYPE = TypeInt
+	}
+	rules, ok := aggregations[s.TYPE]
+	if !ok {
+		return fmt.Errorf("unknown value type %q, use one of %v", s.TYPE, ValueTypes)
+	}
+	if s.AGGREGATION == "" {
+		s.AGGREGATION = rules[0]
+	}
+	for _, rule := range rules {
+		if rule == s.AGGREGATION {
+			return validateKeys(s.KEYS)
+		}
+	}
+	return fmt.Errorf("%s values cannot be decided by %s, use one of %v", s.TYPE, s.AGGREGATION, rules)
+}
+
+// `IsDefault` reports whether the spec is DefaultValueSpec
+func (s ValueSpec) IsDefault() bool {
+	return s.TYPE == DefaultValueSpec.TYPE && s.AGGREGATION == DefaultValueSpec.AGGREGATION && len(s.KEYS) == 0
+}
+
+// `Decide` applies the aggregation of the spec to the values
+// `votes` reported, in the order they were received. Votes that are
+// not values of the type are ignored. It returns the empty value if
+// no value can be decided. Games of keys decide each key on its own.
+func (s ValueSpec) Decide(votes []Value) Value {
+	if len(s.KEYS) > 0 {
+		return s.decideFacts(votes)
+	}
+	values := make([]Value, 0, len(votes))
+	for _, vote := range votes {
+		if value, err := s.TYPE.Canonical(string(vote)); err == nil {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	switch s.AGGREGATION {
+	case AggregateMedian:
+		if s.TYPE == TypeInt {
+			ints := sortedInts(values)
+			return Value(strconv.FormatInt(ints[(len(ints)-1)/2], 10))
+		}
+		numbers := s.numbers(values)
+		return s.number(numbers[(len(numbers)-1)/2])
+	case AggregateTrimmedMean:
+		if s.TYPE == TypeInt {
+			ints := sortedInts(values)
+			trim := int(float64(len(ints)) * trimFraction)
+			return Value(strconv.FormatInt(intMean(ints[trim:len(ints)-trim]), 10))
+		}
+		numbers := s.numbers(values)
+		trim := int(float64(len(numbers)) * trimFraction)
+		numbers = numbers[trim : len(numbers)-trim]
+		if numbers[0] == numbers[len(numbers)-1] {
+			// the same value everywhere, without rounding errors
+			return s.number(numbers[0])
+		}
+		sum := 0.0
+		for _, n := range numbers {
+			sum += n
+		}
+		return s.number(sum / float64(len(numbers)))
+	case AggregateExact:
+		for _, value := range values {
+			if value != values[0] {
+				return ""
+			}
+		}
+		return values[0]
+	}
+
+	// the stable sort breaks ties in favour of the value received first
+	counts := make(map[Value]int)
+	order := make([]Value, 0)
+	for _, value := range values {
+		if counts[value] == 0 {
+			order = append(order, value)
+		}
+		counts[value]++
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	return order[0]
+}
+
+// `numbers` are the sorted numbers of canonical numeric `values`
+func (s ValueSpec) numbers(values []Value) []float64 {
+	numbers := make([]float64, len(values))
+	for i, value := range values {
+		numbers[i], _ = strconv.ParseFloat(string(value), 64)
+	}
+	sort.Float64s(numbers)
+	return numbers
+}
+
+// `sortedInts` are the sorted integers of canonical int `values`.
+// Ints are aggregated without going through floats, which hold
+// integers exactly only up to 2^53.
+func sortedInts(values []Value) []int64 {
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		ints[i], _ = strconv.ParseInt(string(value), 10, 64)
+	}
+	sort.Slice(ints, func(i, j int) bool { return ints[i] < ints[j] })
+	return ints
+}
+
+// `intMean` is the mean of `ints` rounded to the nearest integer,
+// halves away from zero like math.Round. The sum is taken with big
+// integers so that it cannot overflow.
+func intMean(ints []int64) int64 {
+	sum := new(big.Int)
+	for _, i := range ints {
+		sum.Add(sum, big.NewInt(i))
+	}
+	count := big.NewInt(int64(len(ints)))
+	mean, rest := new(big.Int).QuoRem(sum, count, new(big.Int))
+	if rest.Abs(rest).Lsh(rest, 1).Cmp(count) >= 0 {
+		mean.Add(mean, big.NewInt(int64(sum.Sign())))
+	}
+	// the mean lies between the lowest and highest int
+	return mean.Int64()
+}
+
+// `number` is the value of number `n` in the type of the spec,
+// rounded to the nearest integer for int values
+func (s ValueSpec) number(n float64) Value {
+	if s.TYPE == TypeInt {
+		return Value(strconv.FormatInt(int64(math.Round(n)), 10))
+	}
+	return floatValue(n)
+}
+
+// `GetValueSpec` returns the value spec of game `game`, or the
+// default spec if the game is not registered or does not set one
+func GetValueSpec(game string) (ValueSpec, error) {
+	entry, ok := FindGame(game)
+	if !ok {
+		return DefaultValueSpec, nil
+	}
+	config, err := ReadGameConfig(entry.CONFIG)
+	if err != nil {
+		return DefaultValueSpec, err
+	}
+	return config.ValueSpec()
+}
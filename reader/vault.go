@@ -0,0 +1,98 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// supported vault backends
+const (
+	BackendBitcask = "bitcask"
+	BackendBolt    = "bolt"
+	BackendMemory  = "memory"
+)
+
+// ErrKeyNotFound is returned by every backend when a key is missing
+var ErrKeyNotFound = errors.New("key not found")
+
+// Vault is the key-value store holding the state of an agent.
+// All methods are safe for concurrent use.
+type Vault interface {
+	// Get returns the value of `key` or ErrKeyNotFound
+	Get(key []byte) ([]byte, error)
+	// Put stores `value` under `key`
+	Put(key []byte, value []byte) error
+	// Delete removes `key`; deleting a missing key is not an error
+	Delete(key []byte) error
+	// Len returns the number of keys
+	Len() int
+	// Iterate calls `fn` for every key/value pair until it returns an error.
+	// `fn` must not call back into the vault.
+	Iterate(fn func(key []byte, value []byte) error) error
+	// Close flushes and closes the vault
+	Close() error
+	// Snapshot returns a point-in-time copy of all key/value pairs
+	Snapshot() (map[string][]byte, error)
+	// View runs `fn` in a read-only transaction
+	View(fn func(tx Tx) error) error
+	// Update runs `fn` in a read/write transaction. Its writes are
+	// applied only if `fn` returns nil, and all of them or none.
+	Update(fn func(tx Tx) error) error
+	// CompareAndSwap stores `new` under `key` if its current value is
+	// `old`, where a nil `old` means the key must be absent
+	CompareAndSwap(key []byte, old []byte, new []byte) (bool, error)
+}
+
+// backend is implemented by every storage engine. Locking and
+// transactions are layered on top of it by lockedVault.
+type backend interface {
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	Len() int
+	Iterate(fn func(key []byte, value []byte) error) error
+	Close() error
+	Snapshot() (map[string][]byte, error)
+}
+
+// vaultBackend is the backend used to open new vaults
+var vaultBackend = BackendBitcask
+
+// `SetVaultBackend` selects the backend used for vaults
+// opened from now on
+func SetVaultBackend(backend string) error {
+	switch backend {
+	case BackendBitcask, BackendBolt, BackendMemory:
+		vaultBackend = backend
+		return nil
+	}
+	return fmt.Errorf("unknown vault backend %q", backend)
+}
+
+// `OpenVault` opens the vault stored in `dir` with the selected backend
+func OpenVault(dir string) (Vault, error) {
+	var b backend
+	var err error
+	switch vaultBackend {
+	case BackendBolt:
+		b, err = openBoltVault(dir)
+	case BackendMemory:
+		b = openMemoryVault(dir)
+	default:
+		b, err = openBitcaskVault(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockedVault{b: b}, nil
+}
+
+// `snapshotOf` copies every pair of a backend using Iterate
+func snapshotOf(v backend) (map[string][]byte, error) {
+	snapshot := make(map[string][]byte)
+	err := v.Iterate(func(key []byte, value []byte) error {
+		snapshot[string(key)] = append([]byte(nil), value...)
+		return nil
+	})
+	return snapshot, err
+}
@@ -0,0 +1,79 @@
+package reader
+
+import (
+	"errors"
+
+	"git.mills.io/prologic/bitcask"
+)
+
+// bitcaskVault is a Vault backed by bitcask
+type bitcaskVault struct {
+	db *bitcask.Bitcask
+}
+
+// `openBitcaskVault` opens a bitcask vault in `dir`
+func openBitcaskVault(dir string) (backend, error) {
+	db, err := bitcask.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &bitcaskVault{db: db}, nil
+}
+
+func (v *bitcaskVault) Get(key []byte) ([]byte, error) {
+	value, err := v.db.Get(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (v *bitcaskVault) Put(key []byte, value []byte) error {
+	return v.db.Put(key, value)
+}
+
+func (v *bitcaskVault) Delete(key []byte) error {
+	return v.db.Delete(key)
+}
+
+func (v *bitcaskVault) Len() int {
+	return v.db.Len()
+}
+
+// Iterate collects the keys first: Fold holds the read lock of
+// bitcask, which Get takes again
+func (v *bitcaskVault) Iterate(fn func(key []byte, value []byte) error) error {
+	var keys [][]byte
+	err := v.db.Fold(func(key []byte) error {
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		value, err := v.db.Get(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			// deleted since Fold
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *bitcaskVault) Close() error {
+	if err := v.db.Sync(); err != nil {
+		return err
+	}
+	return v.db.Close()
+}
+
+func (v *bitcaskVault) Snapshot() (map[string][]byte, error) {
+	return snapshotOf(v)
+}
@@ -0,0 +1,85 @@
+package reader
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the single bucket holding the pairs of a vault
+var boltBucket = []byte("vault")
+
+// boltVault is a Vault backed by a bbolt file
+type boltVault struct {
+	db *bolt.DB
+}
+
+// `openBoltVault` opens a bbolt vault in `dir`
+func openBoltVault(dir string) (backend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, "vault.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltVault{db: db}, nil
+}
+
+func (v *boltVault) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := v.db.View(func(tx *bolt.Tx) error {
+		found := tx.Bucket(boltBucket).Get(key)
+		if found == nil {
+			return ErrKeyNotFound
+		}
+		value = append([]byte(nil), found...)
+		return nil
+	})
+	return value, err
+}
+
+func (v *boltVault) Put(key []byte, value []byte) error {
+	return v.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(key, value)
+	})
+}
+
+func (v *boltVault) Delete(key []byte) error {
+	return v.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(key)
+	})
+}
+
+func (v *boltVault) Len() int {
+	n := 0
+	v.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+func (v *boltVault) Iterate(fn func(key []byte, value []byte) error) error {
+	return v.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(fn)
+	})
+}
+
+func (v *boltVault) Close() error {
+	return v.db.Close()
+}
+
+func (v *boltVault) Snapshot() (map[string][]byte, error) {
+	return snapshotOf(v)
+}
@@ -0,0 +1,91 @@
+package reader
+
+import (
+	"sort"
+	"sync"
+)
+
+// memoryStores keeps memory vaults by directory, so that a
+// vault reopened within the same process sees earlier writes
+var memoryStores = struct {
+	sync.Mutex
+	vaults map[string]*memoryVault
+}{vaults: make(map[string]*memoryVault)}
+
+// memoryVault is a Vault kept in memory, mostly useful for tests
+type memoryVault struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// `openMemoryVault` opens the memory vault registered for `dir`
+func openMemoryVault(dir string) backend {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	v, ok := memoryStores.vaults[dir]
+	if !ok {
+		v = &memoryVault{data: make(map[string][]byte)}
+		memoryStores.vaults[dir] = v
+	}
+	return v
+}
+
+func (v *memoryVault) Get(key []byte) ([]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.data[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (v *memoryVault) Put(key []byte, value []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (v *memoryVault) Delete(key []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.data, string(key))
+	return nil
+}
+
+func (v *memoryVault) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.data)
+}
+
+// Iterate visits keys in sorted order so that runs are reproducible
+func (v *memoryVault) Iterate(fn func(key []byte, value []byte) error) error {
+	snapshot, _ := v.Snapshot()
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn([]byte(key), snapshot[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *memoryVault) Close() error {
+	return nil
+}
+
+func (v *memoryVault) Snapshot() (map[string][]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	snapshot := make(map[string][]byte, len(v.data))
+	for key, value := range v.data {
+		snapshot[key] = append([]byte(nil), value...)
+	}
+	return snapshot, nil
+}
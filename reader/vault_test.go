@@ -0,0 +1,133 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// backends lists every vault backend the tests run against
+var backends = []string{BackendMemory, BackendBolt, BackendBitcask}
+
+// `openTestVault` opens an empty vault of `backend` in a temporary
+// directory, closed when the test ends
+func openTestVault(t *testing.T, backend string) Vault {
+	t.Helper()
+	if err := SetVaultBackend(backend); err != nil {
+		t.Fatal(err)
+	}
+	defer SetVaultBackend(BackendBitcask)
+	v, err := OpenVault(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v
+}
+
+// `forEachBackend` runs `test` as a subtest for every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, v Vault)) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			test(t, openTestVault(t, backend))
+		})
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		if _, err := v.Get([]byte("missing")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("get of a missing key: %v, want ErrKeyNotFound", err)
+		}
+		if err := v.Put([]byte("value"), []byte("42")); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Put([]byte("value"), []byte("43")); err != nil {
+			t.Fatal(err)
+		}
+		value, err := v.Get([]byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != "43" {
+			t.Errorf("got %q, want %q", value, "43")
+		}
+		if v.Len() != 1 {
+			t.Errorf("%d keys, want 1", v.Len())
+		}
+	})
+}
+
+func TestVaultIterate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		want := make(map[string]string)
+		for i := 0; i < 20; i++ {
+			key, value := fmt.Sprintf("key%02d", i), fmt.Sprint(i)
+			if err := v.Put([]byte(key), []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+		}
+		got := make(map[string]string)
+		err := v.Iterate(func(key []byte, value []byte) error {
+			got[string(key)] = string(value)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("iterated %v, want %v", got, want)
+		}
+
+		stop := errors.New("stop")
+		visited := 0
+		err = v.Iterate(func(key []byte, value []byte) error {
+			visited++
+			return stop
+		})
+		if !errors.Is(err, stop) || visited != 1 {
+			t.Errorf("iterate returned %v after %d pairs, want stop after 1", err, visited)
+		}
+
+		snapshot, err := v.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshot) != len(want) {
+			t.Errorf("snapshot of %d pairs, want %d", len(snapshot), len(want))
+		}
+	})
+}
+
+func TestVaultDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		if err := v.Put([]byte("kept"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Put([]byte("deleted"), []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Delete([]byte("deleted")); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Delete([]byte("missing")); err != nil {
+			t.Errorf("delete of a missing key: %v", err)
+		}
+		if _, err := v.Get([]byte("deleted")); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("get of a deleted key: %v, want ErrKeyNotFound", err)
+		}
+		if v.Len() != 1 {
+			t.Errorf("%d keys, want 1", v.Len())
+		}
+		err := v.Iterate(func(key []byte, value []byte) error {
+			if string(key) != "kept" {
+				t.Errorf("iterated deleted key %s", key)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrReadOnly is returned when writing in a read-only transaction
+var ErrReadOnly = errors.New("read-only transaction")
+
+// Tx is a transaction on a vault
+type Tx interface {
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+}
+
+// lockedVault serializes access to a backend. Reads share the lock,
+// writes and read/write transactions hold it exclusively, so that
+// concurrent agents never observe a half-applied transaction.
+type lockedVault struct {
+	mu sync.RWMutex
+	b  backend
+}
+
+func (v *lockedVault) Get(key []byte) ([]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.b.Get(key)
+}
+
+func (v *lockedVault) Put(key []byte, value []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.b.Put(key, value)
+}
+
+func (v *lockedVault) Delete(key []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.b.Delete(key)
+}
+
+func (v *lockedVault) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.b.Len()
+}
+
+func (v *lockedVault) Iterate(fn func(key []byte, value []byte) error) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.b.Iterate(fn)
+}
+
+func (v *lockedVault) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.b.Close()
+}
+
+func (v *lockedVault) Snapshot() (map[string][]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.b.Snapshot()
+}
+
+func (v *lockedVault) View(fn func(tx Tx) error) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return fn(&readTx{b: v.b})
+}
+
+func (v *lockedVault) Update(fn func(tx Tx) error) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	tx := &writeTx{b: v.b, pending: make(map[string][]byte)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+func (v *lockedVault) CompareAndSwap(key []byte, old []byte, new []byte) (bool, error) {
+	swapped := false
+	err := v.Update(func(tx Tx) error {
+		current, err := tx.Get(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			current = nil
+		} else if err != nil {
+			return err
+		}
+		if (old == nil) != (current == nil) || !bytes.Equal(current, old) {
+			return nil
+		}
+		swapped = true
+		return tx.Put(key, new)
+	})
+	return swapped, err
+}
+
+// readTx is a read-only transaction
+type readTx struct {
+	b backend
+}
+
+func (tx *readTx) Get(key []byte) ([]byte, error) {
+	return tx.b.Get(key)
+}
+
+func (tx *readTx) Put(key []byte, value []byte) error {
+	return ErrReadOnly
+}
+
+func (tx *readTx) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+// writeTx buffers writes until the transaction commits. Reads see
+// the writes made earlier in the same transaction. A nil pending
+// value marks a deleted key.
+type writeTx struct {
+	b       backend
+	pending map[string][]byte
+	order   []string
+}
+
+func (tx *writeTx) Get(key []byte) ([]byte, error) {
+	if value, ok := tx.pending[string(key)]; ok {
+		if value == nil {
+			return nil, ErrKeyNotFound
+		}
+		return append([]byte(nil), value...), nil
+	}
+	return tx.b.Get(key)
+}
+
+func (tx *writeTx) Put(key []byte, value []byte) error {
+	tx.stage(key, append([]byte{}, value...))
+	return nil
+}
+
+func (tx *writeTx) Delete(key []byte) error {
+	tx.stage(key, nil)
+	return nil
+}
+
+// `stage` records a pending write, remembering the order of keys
+func (tx *writeTx) stage(key []byte, value []byte) {
+	if _, ok := tx.pending[string(key)]; !ok {
+		tx.order = append(tx.order, string(key))
+	}
+	tx.pending[string(key)] = value
+}
+
+// `commit` applies the pending writes to the backend, all or none:
+// if the backend fails partway, the writes applied so far are undone
+// from the values the keys held before the commit. Only a backend
+// failing again while undoing can leave the transaction half-applied,
+// which the returned error then says.
+func (tx *writeTx) commit() error {
+	previous := make(map[string][]byte, len(tx.order))
+	for _, key := range tx.order {
+		value, err := tx.b.Get([]byte(key))
+		if errors.Is(err, ErrKeyNotFound) {
+			value = nil
+		} else if err != nil {
+			return err
+		}
+		previous[key] = value
+	}
+	for i, key := range tx.order {
+		if err := tx.apply(key, tx.pending[key]); err != nil {
+			for _, done := range tx.order[:i] {
+				if undoErr := tx.apply(done, previous[done]); undoErr != nil {
+					return fmt.Errorf("%w, and undoing the transaction failed: %v", err, undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// `apply` writes `value` under `key` in the backend, deleting the
+// key if `value` is nil
+func (tx *writeTx) apply(key string, value []byte) error {
+	if value == nil {
+		return tx.b.Delete([]byte(key))
+	}
+	return tx.b.Put([]byte(key), value)
+}
@@ -0,0 +1,204 @@
+package reader
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	// workers and increments of the concurrency tests
+	txWorkers    = 16
+	txIncrements = 50
+)
+
+// `counter` reads the integer stored under `key`, 0 if missing
+func counter(t *testing.T, get func(key []byte) ([]byte, error), key string) int {
+	value, err := get([]byte(key))
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0
+	}
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	n, err := strconv.Atoi(string(value))
+	if err != nil {
+		t.Error(err)
+	}
+	return n
+}
+
+// `hammer` runs `fn` from txWorkers goroutines, txIncrements times each
+func hammer(fn func()) {
+	var wg sync.WaitGroup
+	for w := 0; w < txWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < txIncrements; i++ {
+				fn()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Concurrent transactions incrementing two counters together never
+// lose an increment, and readers never see one counter without the
+// other.
+func TestVaultUpdateConcurrent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		done := make(chan struct{})
+		readers := sync.WaitGroup{}
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				v.View(func(tx Tx) error {
+					if a, b := counter(t, tx.Get, "a"), counter(t, tx.Get, "b"); a != b {
+						t.Errorf("read a half-applied transaction: a=%d b=%d", a, b)
+					}
+					return nil
+				})
+			}
+		}()
+
+		hammer(func() {
+			err := v.Update(func(tx Tx) error {
+				for _, key := range []string{"a", "b"} {
+					n := counter(t, tx.Get, key)
+					if err := tx.Put([]byte(key), []byte(strconv.Itoa(n+1))); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+		close(done)
+		readers.Wait()
+
+		for _, key := range []string{"a", "b"} {
+			if n := counter(t, v.Get, key); n != txWorkers*txIncrements {
+				t.Errorf("%s is %d, want %d", key, n, txWorkers*txIncrements)
+			}
+		}
+	})
+}
+
+// Increments made by compare-and-swap retry loops are never lost
+func TestVaultCompareAndSwapConcurrent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		hammer(func() {
+			for {
+				old, err := v.Get([]byte("n"))
+				if errors.Is(err, ErrKeyNotFound) {
+					old = nil
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(string(old))
+				swapped, err := v.CompareAndSwap([]byte("n"), old, []byte(strconv.Itoa(n+1)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if swapped {
+					return
+				}
+			}
+		})
+		if n := counter(t, v.Get, "n"); n != txWorkers*txIncrements {
+			t.Errorf("n is %d, want %d", n, txWorkers*txIncrements)
+		}
+	})
+}
+
+func TestVaultCompareAndSwap(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		swap := func(old []byte, new string, want bool) {
+			t.Helper()
+			swapped, err := v.CompareAndSwap([]byte("key"), old, []byte(new))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if swapped != want {
+				t.Errorf("swap %q for %q: swapped %t, want %t", old, new, swapped, want)
+			}
+		}
+		swap([]byte("1"), "2", false)
+		swap(nil, "1", true)
+		swap(nil, "2", false)
+		swap([]byte("2"), "3", false)
+		swap([]byte("1"), "2", true)
+		if value, _ := v.Get([]byte("key")); string(value) != "2" {
+			t.Errorf("key holds %q, want %q", value, "2")
+		}
+	})
+}
+
+func TestVaultUpdateAbort(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, v Vault) {
+		abort := errors.New("abort")
+		err := v.Update(func(tx Tx) error {
+			if err := tx.Put([]byte("key"), []byte("value")); err != nil {
+				return err
+			}
+			return abort
+		})
+		if !errors.Is(err, abort) {
+			t.Fatalf("update returned %v, want abort", err)
+		}
+		if v.Len() != 0 {
+			t.Errorf("aborted transaction left %d keys", v.Len())
+		}
+	})
+}
+
+// failingBackend fails every write of key `fail`
+type failingBackend struct {
+	backend
+	fail string
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (b *failingBackend) Put(key []byte, value []byte) error {
+	if string(key) == b.fail {
+		return errWriteFailed
+	}
+	return b.backend.Put(key, value)
+}
+
+// A backend failing partway through a commit leaves the vault as it
+// was before the transaction
+func TestVaultUpdateAllOrNothing(t *testing.T) {
+	b := &failingBackend{backend: openMemoryVault(t.TempDir()), fail: "c"}
+	v := &lockedVault{b: b}
+	if err := v.Put([]byte("a"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	err := v.Update(func(tx Tx) error {
+		tx.Put([]byte("a"), []byte("new"))
+		tx.Put([]byte("b"), []byte("new"))
+		tx.Put([]byte("c"), []byte("new"))
+		return nil
+	})
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("update returned %v, want the write failure", err)
+	}
+	snapshot, _ := v.Snapshot()
+	if len(snapshot) != 1 || string(snapshot["a"]) != "old" {
+		t.Errorf("vault holds %q after a failed commit, want only a=old", snapshot)
+	}
+}